@@ -0,0 +1,49 @@
+package kdlconfig
+
+import "time"
+
+// clock is the source of time for a Watcher; tests replace it to control debouncing.
+type clock interface {
+	Now() time.Time
+	// NewTimer returns a stopped timer.
+	NewTimer() timer
+}
+
+// timer is a resettable one-shot timer.
+type timer interface {
+	C() <-chan time.Time
+	// Reset (re)arms the timer to fire after d, discarding a pending expiry.
+	Reset(d time.Duration)
+	Stop()
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer() timer {
+	t := time.NewTimer(time.Hour)
+	t.Stop()
+	return &realTimer{t: t}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (r *realTimer) C() <-chan time.Time { return r.t.C }
+
+func (r *realTimer) Reset(d time.Duration) {
+	r.Stop()
+	r.t.Reset(d)
+}
+
+func (r *realTimer) Stop() {
+	if !r.t.Stop() {
+		// drain an expiry that was not received yet
+		select {
+		case <-r.t.C:
+		default:
+		}
+	}
+}
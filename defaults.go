@@ -0,0 +1,193 @@
+package kdlconfig
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/sblinch/kdl-go/document"
+)
+
+// kdlScope is the part of a document that maps onto a single struct value: the arguments
+// and properties of the node(s) it was unmarshaled from, and their children.
+// The root scope only has children, the top-level nodes.
+type kdlScope struct {
+	args     int
+	props    map[string]bool
+	children []*document.Node
+}
+
+// newScope merges the nodes that were all unmarshaled into the same struct value.
+func newScope(nodes []*document.Node) *kdlScope {
+	s := &kdlScope{props: make(map[string]bool)}
+	for _, n := range nodes {
+		if len(n.Arguments) > s.args {
+			s.args = len(n.Arguments)
+		}
+		for name := range n.Properties.Unordered() {
+			s.props[name] = true
+		}
+		s.children = append(s.children, n.Children...)
+	}
+	return s
+}
+
+// named returns the children called name.
+func (s *kdlScope) named(name string) []*document.Node {
+	var out []*document.Node
+	for _, n := range s.children {
+		if n.Name.ValueString() == name {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// field reports whether the document sets the struct field sf and returns the nodes
+// that were unmarshaled into it. argFields is the number of `,arg` fields of the struct
+// and argIndex the number of them seen so far.
+func (s *kdlScope) field(sf reflect.StructField, argFields int, argIndex *int) (bool, []*document.Node) {
+	if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+		return true, nil
+	}
+	_, attrs := parseKDLTag(sf.Tag.Get("kdl"))
+	for _, attr := range attrs {
+		switch attr {
+		case "arg":
+			*argIndex++
+			return s.args >= *argIndex, nil
+		case "args":
+			return s.args > argFields, nil
+		case "props":
+			return len(s.props) > 0, nil
+		case "children":
+			return len(s.children) > 0, nil
+		}
+	}
+	name := kdlFieldName(sf)
+	nodes := s.named(name)
+	return len(nodes) > 0 || s.props[name], nodes
+}
+
+// appliedDefaults maps the KDL path of every field set from its `default` tag to the tag.
+type appliedDefaults map[string]string
+
+// applyDefaults sets every field of the struct cfg points to that has a `default` tag
+// but was absent from doc, recording the fields it sets. Fields explicitly set in the
+// document, even to a zero value, are left alone. Nested structs are descended into
+// whether or not their node exists, as are the elements of `,multiple` slices and of maps.
+func applyDefaults(cfg any, doc *document.Document) (appliedDefaults, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("applyDefaults: expected pointer to struct, got %T", cfg)
+	}
+	set := make(appliedDefaults)
+	if err := applyStructDefaults(v.Elem(), &kdlScope{children: doc.Nodes}, fieldPath{}, set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func applyStructDefaults(v reflect.Value, scope *kdlScope, path fieldPath, set appliedDefaults) error {
+	t := v.Type()
+
+	argFields := 0
+	for i := 0; i < t.NumField(); i++ {
+		if _, attrs := parseKDLTag(t.Field(i).Tag.Get("kdl")); hasAttr(attrs, "arg") {
+			argFields++
+		}
+	}
+
+	argIndex := 0
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		if !fv.CanSet() {
+			continue
+		}
+		fp := path.field(sf)
+
+		present, nodes := scope.field(sf, argFields, &argIndex)
+		if !present {
+			if raw, ok := sf.Tag.Lookup("default"); ok {
+				if err := setValue(fv, raw); err != nil {
+					return fmt.Errorf("invalid default for %s: %w", fp.goPath, err)
+				}
+				set[fp.kdlPath] = raw
+				continue
+			}
+		}
+
+		inner := newScope(nodes)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			inner = scope
+		} else if _, attrs := parseKDLTag(sf.Tag.Get("kdl")); hasAttr(attrs, "children") {
+			inner = &kdlScope{children: scope.children}
+		}
+		if err := applyNestedDefaults(fv, sf, nodes, inner, fp, set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyNestedDefaults descends into the struct, pointer, slice or map field fv.
+func applyNestedDefaults(fv reflect.Value, sf reflect.StructField, nodes []*document.Node, inner *kdlScope, path fieldPath, set appliedDefaults) error {
+	switch fv.Kind() {
+	case reflect.Struct:
+		return applyStructDefaults(fv, inner, path, set)
+	case reflect.Ptr:
+		if fv.IsNil() || fv.Elem().Kind() != reflect.Struct {
+			return nil
+		}
+		return applyStructDefaults(fv.Elem(), inner, path, set)
+	case reflect.Slice:
+		// elements of a `,multiple` slice map one-to-one onto the repeated nodes
+		_, attrs := parseKDLTag(sf.Tag.Get("kdl"))
+		if !hasAttr(attrs, "multiple") {
+			return nil
+		}
+		for i := 0; i < fv.Len() && i < len(nodes); i++ {
+			if err := applyElemDefaults(fv.Index(i), newScope(nodes[i:i+1]), path.index(i), set); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// map entries are the children of the field's node, keyed by node name
+		if fv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		for _, k := range fv.MapKeys() {
+			scope := newScope(inner.named(k.String()))
+			elem := reflect.New(fv.Type().Elem()).Elem()
+			elem.Set(fv.MapIndex(k))
+			if err := applyElemDefaults(elem, scope, path.key(k), set); err != nil {
+				return err
+			}
+			fv.SetMapIndex(k, elem)
+		}
+	}
+	return nil
+}
+
+// applyElemDefaults applies defaults to a collection element holding a struct or pointer to struct.
+func applyElemDefaults(ev reflect.Value, scope *kdlScope, path fieldPath, set appliedDefaults) error {
+	if ev.Kind() == reflect.Ptr {
+		if ev.IsNil() {
+			return nil
+		}
+		ev = ev.Elem()
+	}
+	if ev.Kind() != reflect.Struct {
+		return nil
+	}
+	return applyStructDefaults(ev, scope, path, set)
+}
+
+func hasAttr(attrs []string, attr string) bool {
+	for _, a := range attrs {
+		if a == attr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package kdlconfig
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sblinch/kdl-go"
+	"github.com/stretchr/testify/require"
+)
+
+type defaultsPool struct {
+	Size    int           `kdl:"size" default:"4"`
+	Timeout time.Duration `kdl:"timeout" default:"30s"`
+}
+
+type defaultsListener struct {
+	Addr string `kdl:"addr"`
+	Port int    `kdl:"port" default:"80"`
+}
+
+type defaultsConfig struct {
+	Port      int                          `kdl:"port" default:"8080"`
+	Debug     bool                         `kdl:"debug" default:"true"`
+	Level     string                       `kdl:"level" default:"info"`
+	Hosts     []string                     `kdl:"hosts" default:"\"a\" \"b\""`
+	Pool      defaultsPool                 `kdl:"pool"`
+	Primary   *defaultsPool                `kdl:"primary" default:"size=2"`
+	Listeners []defaultsListener           `kdl:"listener,multiple"`
+	Upstreams map[string]*defaultsListener `kdl:"upstreams"`
+}
+
+func loadWithDefaults(t *testing.T, content string) *defaultsConfig {
+	t.Helper()
+	cfg := &defaultsConfig{}
+	require.NoError(t, kdl.Unmarshal([]byte(content), cfg))
+	doc, err := kdl.Parse(strings.NewReader(content))
+	require.NoError(t, err)
+	_, err = applyDefaults(cfg, doc)
+	require.NoError(t, err)
+	return cfg
+}
+
+func TestApplyDefaults_Absent(t *testing.T) {
+	cfg := loadWithDefaults(t, "")
+
+	require.Equal(t, 8080, cfg.Port)
+	require.True(t, cfg.Debug)
+	require.Equal(t, "info", cfg.Level)
+	require.Equal(t, []string{"a", "b"}, cfg.Hosts)
+	require.Equal(t, defaultsPool{Size: 4, Timeout: 30 * time.Second}, cfg.Pool)
+	require.NotNil(t, cfg.Primary)
+	require.Equal(t, 2, cfg.Primary.Size)
+}
+
+func TestApplyDefaults_ExplicitZeroKept(t *testing.T) {
+	cfg := loadWithDefaults(t, "port 0\ndebug false\nlevel \"\"\npool {\n    size 0\n}\n")
+
+	require.Equal(t, 0, cfg.Port)
+	require.False(t, cfg.Debug)
+	require.Equal(t, "", cfg.Level)
+	require.Equal(t, 0, cfg.Pool.Size)
+	// siblings of explicitly set fields still get their defaults
+	require.Equal(t, 30*time.Second, cfg.Pool.Timeout)
+}
+
+func TestApplyDefaults_Collections(t *testing.T) {
+	cfg := loadWithDefaults(t, ""+
+		"listener addr=\"a\"\n"+
+		"listener addr=\"b\" port=0\n"+
+		"upstreams {\n"+
+		"    eu addr=\"eu\"\n"+
+		"    us port=443\n"+
+		"}\n")
+
+	require.Equal(t, []defaultsListener{{Addr: "a", Port: 80}, {Addr: "b", Port: 0}}, cfg.Listeners)
+	require.Equal(t, 80, cfg.Upstreams["eu"].Port)
+	require.Equal(t, 443, cfg.Upstreams["us"].Port)
+}
+
+func TestApplyDefaults_InvalidDefault(t *testing.T) {
+	cfg := &struct {
+		Port int `kdl:"port" default:"eighty"`
+	}{}
+	doc, err := kdl.Parse(strings.NewReader(""))
+	require.NoError(t, err)
+
+	_, err = applyDefaults(cfg, doc)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid default for Port")
+}
@@ -0,0 +1,198 @@
+package kdlconfig
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ChangeKind tells how a value differs between two configs.
+type ChangeKind int
+
+const (
+	// Modified means the value is present in both configs but differs.
+	Modified ChangeKind = iota
+	// Added means the value is only present in the new config: a map entry, a slice
+	// element past the end of the old slice, or a pointer that was nil.
+	Added
+	// Removed means the value is only present in the old config.
+	Removed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Modified:
+		return "modified"
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is a difference between two configs found by Diff.
+type Change struct {
+	// Path is the KDL path of the value, e.g. "log.level" or `upstreams["eu"].port`.
+	Path string
+	// Field is the Go path of the value, e.g. "Log.Level".
+	Field string
+	Kind  ChangeKind
+	// Old and New are the value in the old and the new config; Old is nil for Added
+	// and New is nil for Removed.
+	Old, New any
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("%s: added %v", c.Path, c.New)
+	case Removed:
+		return fmt.Sprintf("%s: removed %v", c.Path, c.Old)
+	}
+	return fmt.Sprintf("%s: %v -> %v", c.Path, c.Old, c.New)
+}
+
+// Diff compares two configs of the same type, typically pointers to structs, and
+// returns the values that differ. Structs, pointers, slices, arrays and maps are
+// descended into, so that a change is reported at the deepest path it concerns:
+// a changed port is reported as "database.port", not as a change of "database".
+// Slice elements are compared by index and map entries by key; everything else is
+// compared with reflect.DeepEqual. Changes are ordered by field, index and sorted key.
+//
+// If old and new are of different types, or one of them is nil, a single change
+// for the whole config (with an empty Path) is returned. Cyclic values are supported:
+// like reflect.DeepEqual, Diff does not descend into a pair of pointers, slices or maps
+// it is already comparing further up.
+func Diff(old, new any) []Change {
+	d := &differ{}
+	d.value(reflect.ValueOf(old), reflect.ValueOf(new), fieldPath{})
+	return d.changes
+}
+
+type differ struct {
+	changes []Change
+	// visiting holds the pairs of pointers, slices and maps on the path being compared,
+	// so that cyclic values terminate: a pair met again below itself is taken to be equal.
+	// A pair reachable by several paths is compared at each of them.
+	visiting map[[2]visitKey]bool
+}
+
+// enter records that the pointers, slices or maps old and new are being compared and
+// reports whether they were not already; leave must be called once they are done.
+func (d *differ) enter(old, new reflect.Value) bool {
+	key := [2]visitKey{newVisitKey(old), newVisitKey(new)}
+	if d.visiting[key] {
+		return false
+	}
+	if d.visiting == nil {
+		d.visiting = make(map[[2]visitKey]bool)
+	}
+	d.visiting[key] = true
+	return true
+}
+
+func (d *differ) leave(old, new reflect.Value) {
+	delete(d.visiting, [2]visitKey{newVisitKey(old), newVisitKey(new)})
+}
+
+func (d *differ) value(old, new reflect.Value, path fieldPath) {
+	if !old.IsValid() || !new.IsValid() || old.Type() != new.Type() {
+		switch {
+		case !old.IsValid() && !new.IsValid():
+		case !old.IsValid():
+			d.add(Added, path, old, new)
+		case !new.IsValid():
+			d.add(Removed, path, old, new)
+		default:
+			d.add(Modified, path, old, new)
+		}
+		return
+	}
+
+	switch old.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		switch {
+		case old.IsNil() && new.IsNil():
+		case old.IsNil():
+			d.add(Added, path, reflect.Value{}, new)
+		case new.IsNil():
+			d.add(Removed, path, old, reflect.Value{})
+		default:
+			if old.Kind() == reflect.Ptr {
+				if !d.enter(old, new) {
+					return
+				}
+				defer d.leave(old, new)
+			}
+			d.value(old.Elem(), new.Elem(), path)
+		}
+	case reflect.Struct:
+		if !isStructLike(old.Type()) {
+			d.leaf(old, new, path)
+			return
+		}
+		t := old.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			d.value(old.Field(i), new.Field(i), path.field(sf))
+		}
+	case reflect.Slice, reflect.Array:
+		if old.Kind() == reflect.Slice && !old.IsNil() && !new.IsNil() {
+			if !d.enter(old, new) {
+				return
+			}
+			defer d.leave(old, new)
+		}
+		for i := 0; i < old.Len() || i < new.Len(); i++ {
+			switch {
+			case i >= new.Len():
+				d.add(Removed, path.index(i), old.Index(i), reflect.Value{})
+			case i >= old.Len():
+				d.add(Added, path.index(i), reflect.Value{}, new.Index(i))
+			default:
+				d.value(old.Index(i), new.Index(i), path.index(i))
+			}
+		}
+	case reflect.Map:
+		if !old.IsNil() && !new.IsNil() {
+			if !d.enter(old, new) {
+				return
+			}
+			defer d.leave(old, new)
+		}
+		for _, k := range sortedMapKeys(old) {
+			if nv := new.MapIndex(k); nv.IsValid() {
+				d.value(old.MapIndex(k), nv, path.key(k))
+			} else {
+				d.add(Removed, path.key(k), old.MapIndex(k), reflect.Value{})
+			}
+		}
+		for _, k := range sortedMapKeys(new) {
+			if !old.MapIndex(k).IsValid() {
+				d.add(Added, path.key(k), reflect.Value{}, new.MapIndex(k))
+			}
+		}
+	default:
+		d.leaf(old, new, path)
+	}
+}
+
+func (d *differ) leaf(old, new reflect.Value, path fieldPath) {
+	if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+		d.add(Modified, path, old, new)
+	}
+}
+
+func (d *differ) add(kind ChangeKind, path fieldPath, old, new reflect.Value) {
+	c := Change{Path: path.kdlPath, Field: path.goPath, Kind: kind}
+	if old.IsValid() {
+		c.Old = old.Interface()
+	}
+	if new.IsValid() {
+		c.New = new.Interface()
+	}
+	d.changes = append(d.changes, c)
+}
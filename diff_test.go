@@ -0,0 +1,143 @@
+package kdlconfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type diffUpstream struct {
+	Addr   string `kdl:"addr"`
+	Weight int    `kdl:"weight"`
+}
+
+type diffConfig struct {
+	Log struct {
+		Level string `kdl:"level"`
+	} `kdl:"log"`
+	Timeout   time.Duration            `kdl:"timeout"`
+	TLS       *diffUpstream            `kdl:"tls"`
+	Listeners []diffUpstream           `kdl:"listener,multiple"`
+	Tags      []string                 `kdl:"tags"`
+	Upstreams map[string]*diffUpstream `kdl:"upstreams"`
+	hidden    int
+}
+
+func TestDiff(t *testing.T) {
+	base := func() *diffConfig {
+		c := &diffConfig{Timeout: time.Second, Tags: []string{"a"}}
+		c.Log.Level = "info"
+		c.Listeners = []diffUpstream{{Addr: ":80"}, {Addr: ":81"}}
+		c.Upstreams = map[string]*diffUpstream{"eu": {Addr: "eu:1"}, "us": {Addr: "us:1"}}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *diffConfig)
+		want   []Change
+	}{
+		{
+			name:   "equal",
+			change: func(c *diffConfig) { c.hidden = 1 },
+		},
+		{
+			name:   "nested field",
+			change: func(c *diffConfig) { c.Log.Level = "debug" },
+			want:   []Change{{Path: "log.level", Field: "Log.Level", Kind: Modified, Old: "info", New: "debug"}},
+		},
+		{
+			name:   "scalar",
+			change: func(c *diffConfig) { c.Timeout = 2 * time.Second },
+			want:   []Change{{Path: "timeout", Field: "Timeout", Kind: Modified, Old: time.Second, New: 2 * time.Second}},
+		},
+		{
+			name:   "pointer set",
+			change: func(c *diffConfig) { c.TLS = &diffUpstream{Addr: "tls"} },
+			want:   []Change{{Path: "tls", Field: "TLS", Kind: Added, New: &diffUpstream{Addr: "tls"}}},
+		},
+		{
+			name: "slice elements",
+			change: func(c *diffConfig) {
+				c.Listeners = []diffUpstream{{Addr: ":80", Weight: 2}}
+				c.Tags = []string{"a", "b"}
+			},
+			want: []Change{
+				{Path: "listener[0].weight", Field: "Listeners[0].Weight", Kind: Modified, Old: 0, New: 2},
+				{Path: "listener[1]", Field: "Listeners[1]", Kind: Removed, Old: diffUpstream{Addr: ":81"}},
+				{Path: "tags[1]", Field: "Tags[1]", Kind: Added, New: "b"},
+			},
+		},
+		{
+			name: "map entries",
+			change: func(c *diffConfig) {
+				c.Upstreams["eu"].Weight = 5
+				delete(c.Upstreams, "us")
+				c.Upstreams["ap"] = &diffUpstream{Addr: "ap:1"}
+			},
+			want: []Change{
+				{Path: `upstreams["eu"].weight`, Field: `Upstreams["eu"].Weight`, Kind: Modified, Old: 0, New: 5},
+				{Path: `upstreams["us"]`, Field: `Upstreams["us"]`, Kind: Removed, Old: &diffUpstream{Addr: "us:1"}},
+				{Path: `upstreams["ap"]`, Field: `Upstreams["ap"]`, Kind: Added, New: &diffUpstream{Addr: "ap:1"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, new := base(), base()
+			tt.change(new)
+			require.Equal(t, tt.want, Diff(old, new))
+		})
+	}
+}
+
+func TestDiff_Whole(t *testing.T) {
+	cfg := &diffConfig{}
+	require.Equal(t, []Change{{Kind: Added, New: cfg}}, Diff(nil, cfg))
+	require.Equal(t, []Change{{Kind: Removed, Old: cfg}}, Diff(cfg, nil))
+	require.Equal(t, []Change{{Kind: Modified, Old: cfg, New: 1}}, Diff(cfg, 1))
+	require.Empty(t, Diff(nil, nil))
+}
+
+func TestChange_String(t *testing.T) {
+	require.Equal(t, "log.level: info -> debug", Change{Path: "log.level", Kind: Modified, Old: "info", New: "debug"}.String())
+	require.Equal(t, "tags[1]: added b", Change{Path: "tags[1]", Kind: Added, New: "b"}.String())
+	require.Equal(t, "tags[1]: removed b", Change{Path: "tags[1]", Kind: Removed, Old: "b"}.String())
+}
+
+func TestDiff_Cycles(t *testing.T) {
+	type node struct {
+		Name string
+		Next *node
+		Kids map[string]*node
+	}
+	ring := func(name string) *node {
+		a := &node{Name: "a"}
+		b := &node{Name: name, Next: a, Kids: map[string]*node{"self": nil}}
+		a.Next = b
+		b.Kids["self"] = b
+		return a
+	}
+
+	require.Empty(t, Diff(ring("b"), ring("b")))
+	require.Equal(t, []Change{{Path: "next.name", Field: "Next.Name", Kind: Modified, Old: "b", New: "c"}}, Diff(ring("b"), ring("c")))
+}
+
+func TestDiff_SharedValues(t *testing.T) {
+	type limits struct {
+		Max int
+	}
+	type config struct {
+		Primary, Replica *limits
+	}
+	// both fields share a pointer: a change must be reported under each path
+	oldShared, newShared := &limits{Max: 1}, &limits{Max: 2}
+	old := &config{Primary: oldShared, Replica: oldShared}
+	new := &config{Primary: newShared, Replica: newShared}
+	require.Equal(t, []Change{
+		{Path: "primary.max", Field: "Primary.Max", Kind: Modified, Old: 1, New: 2},
+		{Path: "replica.max", Field: "Replica.Max", Kind: Modified, Old: 1, New: 2},
+	}, Diff(old, new))
+}
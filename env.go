@@ -0,0 +1,134 @@
+package kdlconfig
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// envOverrides maps the KDL path of every field set from the environment to the variable name.
+type envOverrides map[string]string
+
+// applyEnv overrides the fields of the struct cfg points to with the values of the
+// environment variables named after them (see WithEnvPrefix).
+func applyEnv(cfg any, prefix string) (envOverrides, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("applyEnv: expected pointer to struct, got %T", cfg)
+	}
+	set := make(envOverrides)
+	if err := applyStructEnv(v.Elem(), prefix, fieldPath{}, set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// annotate marks the ValidationErrors in err that concern values taken from the environment:
+// their file position is dropped and the variable name is added to the message.
+func (o envOverrides) annotate(err error) error {
+	verrs, ok := err.(ValidationErrors)
+	if !ok || len(o) == 0 {
+		return err
+	}
+	out := make(ValidationErrors, len(verrs))
+	for i, e := range verrs {
+		if name, ok := o.lookup(e.Path); ok {
+			e.Pos = Position{}
+			e.Msg = fmt.Sprintf("%s (from environment variable %s)", e.Msg, name)
+		}
+		out[i] = e
+	}
+	return out
+}
+
+// lookup returns the variable that set the value at path or one of its parents.
+func (o envOverrides) lookup(path string) (string, bool) {
+	return lookupPath(o, path)
+}
+
+// applyStructEnv applies environment overrides to the fields of struct v, recording
+// the fields it sets in set.
+func applyStructEnv(v reflect.Value, prefix string, path fieldPath, set envOverrides) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		if !fv.CanSet() {
+			continue
+		}
+		fp := path.field(sf)
+
+		tag := sf.Tag.Get("env")
+		if tag == "-" {
+			continue
+		}
+
+		if tag == "" && isStructLike(fv.Type()) {
+			if err := applyNestedEnv(fv, prefix, fp, set); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = envName(prefix, fp.kdlPath)
+			// fields without a node of their own (`,arg`, `,props`, ...) and an empty prefix
+			// have no usable derived name
+			if name == "" || fp.kdlPath == path.kdlPath {
+				continue
+			}
+		}
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(fv, raw); err != nil {
+			return fmt.Errorf("invalid value for environment variable %s (%s): %w", name, fp.goPath, err)
+		}
+		set[fp.kdlPath] = name
+	}
+	return nil
+}
+
+// applyNestedEnv descends into a struct or pointer-to-struct field. A nil pointer is only
+// allocated if at least one variable applies to the struct it would point to.
+func applyNestedEnv(fv reflect.Value, prefix string, path fieldPath, set envOverrides) error {
+	if fv.Kind() == reflect.Struct {
+		return applyStructEnv(fv, prefix, path, set)
+	}
+	if !fv.IsNil() {
+		return applyStructEnv(fv.Elem(), prefix, path, set)
+	}
+	before := len(set)
+	elem := reflect.New(fv.Type().Elem())
+	if err := applyStructEnv(elem.Elem(), prefix, path, set); err != nil {
+		return err
+	}
+	if len(set) > before {
+		fv.Set(elem)
+	}
+	return nil
+}
+
+// isStructLike reports whether t is a struct or pointer to struct that should be descended
+// into rather than parsed from a single value.
+func isStructLike(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	return !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// envName derives the environment variable name for the KDL path, or "" if prefix is empty.
+func envName(prefix, kdlPath string) string {
+	if prefix == "" {
+		return ""
+	}
+	name := strings.NewReplacer(".", "_", "-", "_").Replace(kdlPath)
+	return strings.ToUpper(prefix + "_" + name)
+}
@@ -0,0 +1,79 @@
+package kdlconfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type envPrimary struct {
+	Port int    `kdl:"port"`
+	Host string `kdl:"host"`
+}
+
+type envConfig struct {
+	Name     string `kdl:"name"`
+	LogLevel string `kdl:"log-level"`
+	Database struct {
+		Primary  envPrimary    `kdl:"primary"`
+		Replica  *envPrimary   `kdl:"replica"`
+		Standby  *envPrimary   `kdl:"standby"`
+		Password string        `kdl:"password" env:"DB_PASSWORD"`
+		Timeout  time.Duration `kdl:"timeout"`
+	} `kdl:"database"`
+	Hosts  []string `kdl:"hosts"`
+	Secret string   `kdl:"secret" env:"-"`
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("APP_NAME", "from-env")
+	t.Setenv("APP_LOG_LEVEL", "debug")
+	t.Setenv("APP_DATABASE_PRIMARY_PORT", "5433")
+	t.Setenv("APP_DATABASE_REPLICA_HOST", "replica.local")
+	t.Setenv("APP_DATABASE_TIMEOUT", "2s")
+	t.Setenv("DB_PASSWORD", "hunter2")
+	t.Setenv("APP_DATABASE_PASSWORD", "ignored: explicit tag wins")
+	t.Setenv("APP_HOSTS", `"a" "b"`)
+	t.Setenv("APP_SECRET", "ignored: opted out")
+
+	cfg := &envConfig{}
+	cfg.Database.Primary.Host = "primary.local"
+
+	set, err := applyEnv(cfg, "APP")
+	require.NoError(t, err)
+
+	require.Equal(t, "from-env", cfg.Name)
+	require.Equal(t, "debug", cfg.LogLevel)
+	require.Equal(t, envPrimary{Port: 5433, Host: "primary.local"}, cfg.Database.Primary)
+	require.NotNil(t, cfg.Database.Replica)
+	require.Equal(t, "replica.local", cfg.Database.Replica.Host)
+	require.Nil(t, cfg.Database.Standby, "pointers without any variable stay nil")
+	require.Equal(t, 2*time.Second, cfg.Database.Timeout)
+	require.Equal(t, "hunter2", cfg.Database.Password)
+	require.Equal(t, []string{"a", "b"}, cfg.Hosts)
+	require.Empty(t, cfg.Secret)
+
+	require.Equal(t, "APP_DATABASE_PRIMARY_PORT", set["database.primary.port"])
+	require.Equal(t, "DB_PASSWORD", set["database.password"])
+}
+
+func TestApplyEnv_ExplicitTagsOnly(t *testing.T) {
+	t.Setenv("_NAME", "ignored")
+	t.Setenv("DB_PASSWORD", "hunter2")
+
+	cfg := &envConfig{}
+	_, err := applyEnv(cfg, "")
+	require.NoError(t, err)
+	require.Empty(t, cfg.Name)
+	require.Equal(t, "hunter2", cfg.Database.Password)
+}
+
+func TestApplyEnv_InvalidValue(t *testing.T) {
+	t.Setenv("APP_DATABASE_PRIMARY_PORT", "not-a-port")
+
+	_, err := applyEnv(&envConfig{}, "APP")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "APP_DATABASE_PRIMARY_PORT")
+	require.Contains(t, err.Error(), "Database.Primary.Port")
+}
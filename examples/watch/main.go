@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/ykhdr/kdl-config"
@@ -13,10 +14,12 @@ type Config struct {
 
 func main() {
 	// Start watching config.kdl; callback fires on initial load and on each valid change
-	watcher, err := kdlconfig.Watch("config.kdl", &Config{}, func(newCfg any) {
-		cfg := newCfg.(*Config)
+	watcher, err := kdlconfig.WatchTyped("config.kdl", func(cfg *Config) {
 		fmt.Printf("Config updated: %+v\n", cfg)
-	})
+	}, kdlconfig.WithErrorHandler(func(err error) {
+		// an invalid change keeps the previous config
+		log.Printf("config not reloaded: %v", err)
+	}))
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,199 @@
+package kdlconfig
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sblinch/kdl-go/document"
+)
+
+const (
+	// defaultIncludeDirective is the node name that includes other files, see WithIncludeDirective.
+	defaultIncludeDirective = "include"
+	// defaultMaxIncludeDepth is how deeply includes may be nested, see WithMaxIncludeDepth.
+	defaultMaxIncludeDepth = 10
+)
+
+var (
+	// ErrIncludeCycle is wrapped by the error returned when a file includes itself,
+	// directly or through other files.
+	ErrIncludeCycle = errors.New("include cycle")
+	// ErrIncludeDepth is wrapped by the error returned when includes are nested deeper
+	// than the Loader allows.
+	ErrIncludeDepth = errors.New("includes nested too deeply")
+)
+
+// includer replaces include directives with the nodes of the files they name.
+type includer struct {
+	l         *Loader
+	src       *source
+	directive string
+	maxDepth  int
+	// stack holds the files currently being included, outermost first, to detect cycles;
+	// names holds the same files as they were named.
+	stack []string
+	names []string
+	found bool
+}
+
+// resolveIncludes splices the files named by the top-level include directives into src.
+// Included files are resolved relative to the file that includes them, may use glob
+// patterns, and may include further files. The positions of included nodes point into
+// the file they were read from, and every file read is added to src.includes.
+//
+// If any file was included, nodes repeated at the same level are then merged according
+// to the struct cfg points to (see mergeNodes).
+func (l *Loader) resolveIncludes(cfg any, src *source) error {
+	if l.noInclude {
+		return nil
+	}
+	in := &includer{
+		l:         l,
+		src:       src,
+		directive: l.include,
+		maxDepth:  l.maxIncludeDepth,
+		stack:     []string{l.fileID(src.name)},
+		names:     []string{src.name},
+	}
+	if in.directive == "" {
+		in.directive = defaultIncludeDirective
+	}
+	if in.maxDepth <= 0 {
+		in.maxDepth = defaultMaxIncludeDepth
+	}
+
+	nodes, err := in.nodes(src.doc.Nodes, src.name)
+	if err != nil {
+		return err
+	}
+	if !in.found {
+		return nil
+	}
+	src.doc.Nodes = mergeNodes(cfg, nodes, src.pos, nil)
+	src.data = nil
+	return nil
+}
+
+// nodes returns the top-level nodes of file with every include directive replaced.
+// Nodes of that name further down are left alone, so that a struct can still have a
+// field called include.
+func (in *includer) nodes(nodes []*document.Node, file string) ([]*document.Node, error) {
+	out := make([]*document.Node, 0, len(nodes))
+	for _, n := range nodes {
+		if n.Name.ValueString() != in.directive {
+			out = append(out, n)
+			continue
+		}
+		in.found = true
+		included, err := in.include(n, file)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, included...)
+	}
+	return out, nil
+}
+
+// include reads the files matched by the patterns of directive n and returns their nodes.
+func (in *includer) include(n *document.Node, file string) ([]*document.Node, error) {
+	pos := Position{File: in.src.name}
+	if np, ok := in.src.pos[n]; ok {
+		pos = np.Position
+	}
+	if len(n.Arguments) == 0 || n.Properties.Len() > 0 || len(n.Children) > 0 {
+		return nil, fmt.Errorf("%s: %s takes one or more file patterns as arguments", pos, in.directive)
+	}
+	if len(in.stack) > in.maxDepth {
+		return nil, fmt.Errorf("%s: %w (max %d)", pos, ErrIncludeDepth, in.maxDepth)
+	}
+
+	var out []*document.Node
+	for _, arg := range n.Arguments {
+		pattern, ok := arg.ResolvedValue().(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s: file pattern must be a string, got %s", pos, in.directive, arg.ValueString())
+		}
+		paths, err := in.l.glob(in.l.resolvePath(file, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s %q: %w", pos, in.directive, pattern, err)
+		}
+		for _, p := range paths {
+			nodes, err := in.file(p, pos)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, nodes...)
+		}
+	}
+	return out, nil
+}
+
+// file reads, parses and resolves the included file p; pos is the directive including it.
+func (in *includer) file(p string, pos Position) ([]*document.Node, error) {
+	id := in.l.fileID(p)
+	for i, f := range in.stack {
+		if f == id {
+			chain := append(append([]string(nil), in.names[i:]...), p)
+			return nil, fmt.Errorf("%s: %w: %s", pos, ErrIncludeCycle, strings.Join(chain, " -> "))
+		}
+	}
+
+	data, err := in.l.readFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to read included file %q: %w", pos, p, err)
+	}
+	inc, err := parseSource(p, data)
+	if err != nil {
+		return nil, err
+	}
+	for n, np := range inc.pos {
+		in.src.pos[n] = np
+	}
+	in.src.includes = append(in.src.includes, p)
+
+	in.stack = append(in.stack, id)
+	in.names = append(in.names, p)
+	defer func() {
+		in.stack = in.stack[:len(in.stack)-1]
+		in.names = in.names[:len(in.names)-1]
+	}()
+	return in.nodes(inc.doc.Nodes, p)
+}
+
+// resolvePath resolves the include pattern relative to the directory of file.
+func (l *Loader) resolvePath(file, pattern string) string {
+	if l.fsys != nil {
+		return path.Join(path.Dir(file), pattern)
+	}
+	if filepath.IsAbs(pattern) {
+		return pattern
+	}
+	return filepath.Join(filepath.Dir(file), pattern)
+}
+
+// glob expands pattern into the sorted list of matching files. A pattern without
+// wildcards is returned as is, so that a missing file is reported when it is read.
+func (l *Loader) glob(pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, `*?[\`) {
+		return []string{pattern}, nil
+	}
+	if l.fsys != nil {
+		return fs.Glob(l.fsys, pattern)
+	}
+	return filepath.Glob(pattern)
+}
+
+// fileID returns the name under which p is tracked for cycle detection.
+func (l *Loader) fileID(p string) string {
+	if l.fsys != nil {
+		return path.Clean(p)
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return filepath.Clean(p)
+}
@@ -0,0 +1,256 @@
+package kdlconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+type includeListener struct {
+	Addr string `kdl:"addr" validate:"required"`
+	TLS  bool   `kdl:"tls"`
+}
+
+type includeConfig struct {
+	Name     string `kdl:"name"`
+	Database struct {
+		Host string `kdl:"host"`
+		Port int    `kdl:"port" validate:"max=65535"`
+	} `kdl:"database"`
+	Listeners []includeListener `kdl:"listener,multiple"`
+	Tags      []string          `kdl:"tags"`
+	Limits    map[string]int    `kdl:"limits"`
+}
+
+// writeFiles writes files (relative path → content) under a new temp dir and returns it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+	return dir
+}
+
+func TestLoader_Include(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.kdl": "name \"svc\"\ninclude \"conf/db.kdl\" \"listeners/*.kdl\"\n",
+		"conf/db.kdl": "database {\n    host \"db\"\n}\n" +
+			// nested includes resolve relative to the including file
+			"include \"db-port.kdl\"\n",
+		"conf/db-port.kdl":      "database {\n    port 5432\n}\n",
+		"listeners/a-http.kdl":  "listener addr=\":80\"\n",
+		"listeners/b-https.kdl": "listener addr=\":443\" tls=true\n",
+	})
+
+	cfg := &includeConfig{}
+	require.NoError(t, NewLoader().Load(cfg, filepath.Join(dir, "config.kdl")))
+	require.Equal(t, "svc", cfg.Name)
+	require.Equal(t, "db", cfg.Database.Host)
+	require.Equal(t, 5432, cfg.Database.Port)
+	require.Equal(t, []includeListener{{Addr: ":80"}, {Addr: ":443", TLS: true}}, cfg.Listeners)
+}
+
+func TestLoader_IncludeMerge(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.kdl": "database host=\"a\" port=1\ntags \"a\" \"b\"\nlimits {\n    read 1\n    write 2\n}\n" +
+			"listener addr=\":80\"\ninclude \"override.kdl\"\n",
+		"override.kdl": "database port=2\ntags \"c\"\nlimits {\n    write 3\n}\nlistener addr=\":81\"\n",
+	})
+
+	cfg := &includeConfig{}
+	require.NoError(t, NewLoader().Load(cfg, filepath.Join(dir, "config.kdl")))
+	require.Equal(t, "a", cfg.Database.Host)
+	require.Equal(t, 2, cfg.Database.Port)
+	require.Equal(t, []string{"c"}, cfg.Tags, "arguments are replaced, not appended")
+	require.Equal(t, map[string]int{"read": 1, "write": 3}, cfg.Limits)
+	require.Len(t, cfg.Listeners, 2, "multiple nodes are all kept")
+}
+
+func TestLoader_IncludePositions(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.kdl":        "name \"svc\"\ninclude \"extra/*.kdl\"\n",
+		"extra/db.kdl":      "database {\n    host \"db\"\n    port 70000\n}\n",
+		"extra/listen.kdl":  "\nlistener addr=\"\"\n",
+		"extra/typo.kdl.md": "ignored, does not match the glob",
+	})
+	dbFile := filepath.Join(dir, "extra", "db.kdl")
+	listenFile := filepath.Join(dir, "extra", "listen.kdl")
+
+	err := NewLoader().Load(&includeConfig{}, filepath.Join(dir, "config.kdl"))
+	verrs, ok := err.(ValidationErrors)
+	require.True(t, ok, "expected ValidationErrors, got %T: %v", err, err)
+	require.Len(t, verrs, 2)
+	require.Equal(t, Position{File: dbFile, Line: 3, Column: 10}, verrs[0].Pos)
+	require.Equal(t, Position{File: listenFile, Line: 2, Column: 10}, verrs[1].Pos)
+
+	// strict mode errors point into the included file too
+	require.NoError(t, os.WriteFile(listenFile, []byte("listener adr=\":80\"\n"), 0o644))
+	err = NewLoader().Load(&includeConfig{}, filepath.Join(dir, "config.kdl"))
+	require.ErrorContains(t, err, listenFile+`:1:10: listener.adr: unknown property "adr", did you mean "addr"?`)
+
+	// and so do syntax errors
+	require.NoError(t, os.WriteFile(listenFile, []byte("listener 1 }\n"), 0o644))
+	err = NewLoader().Load(&includeConfig{}, filepath.Join(dir, "config.kdl"))
+	var uerr *UnmarshalError
+	require.True(t, errors.As(err, &uerr), "expected UnmarshalError, got %T: %v", err, err)
+	require.Equal(t, listenFile, uerr.Pos.File)
+}
+
+func TestLoader_IncludeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		opts    []Option
+		wantIs  error
+		wantMsg string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"config.kdl": "include \"a.kdl\"\n",
+				"a.kdl":      "include \"b.kdl\"\n",
+				"b.kdl":      "include \"a.kdl\"\n",
+			},
+			wantIs:  ErrIncludeCycle,
+			wantMsg: "a.kdl -> ",
+		},
+		{
+			name:    "self include",
+			files:   map[string]string{"config.kdl": "include \"config.kdl\"\n"},
+			wantIs:  ErrIncludeCycle,
+			wantMsg: "config.kdl:1:1: include cycle",
+		},
+		{
+			name: "too deep",
+			files: map[string]string{
+				"config.kdl": "include \"a.kdl\"\n",
+				"a.kdl":      "include \"b.kdl\"\n",
+				"b.kdl":      "name \"x\"\n",
+			},
+			opts:    []Option{WithMaxIncludeDepth(1)},
+			wantIs:  ErrIncludeDepth,
+			wantMsg: "a.kdl:1:1: includes nested too deeply (max 1)",
+		},
+		{
+			name:    "missing file",
+			files:   map[string]string{"config.kdl": "\ninclude \"missing.kdl\"\n"},
+			wantIs:  os.ErrNotExist,
+			wantMsg: "config.kdl:2:1: failed to read included file",
+		},
+		{
+			name:    "no pattern",
+			files:   map[string]string{"config.kdl": "include\n"},
+			wantMsg: "include takes one or more file patterns as arguments",
+		},
+		{
+			name:    "non-string pattern",
+			files:   map[string]string{"config.kdl": "include 1\n"},
+			wantMsg: "file pattern must be a string, got 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			err := NewLoader(tt.opts...).Load(&includeConfig{}, filepath.Join(dir, "config.kdl"))
+			require.Error(t, err)
+			if tt.wantIs != nil {
+				require.ErrorIs(t, err, tt.wantIs)
+			}
+			require.Contains(t, err.Error(), tt.wantMsg)
+		})
+	}
+}
+
+func TestLoader_IncludeGlobWithoutMatches(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"config.kdl": "name \"svc\"\ninclude \"conf.d/*.kdl\"\n"})
+
+	cfg := &includeConfig{}
+	require.NoError(t, NewLoader().Load(cfg, filepath.Join(dir, "config.kdl")))
+	require.Equal(t, "svc", cfg.Name)
+}
+
+func TestLoader_IncludeFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"etc/app/config.kdl":     {Data: []byte("name \"svc\"\ninclude \"../shared/*.kdl\"\n")},
+		"etc/shared/db.kdl":      {Data: []byte("database host=\"db\"\n")},
+		"etc/shared/listen.kdl":  {Data: []byte("listener addr=\":80\"\n")},
+		"etc/shared/ignored.txt": {Data: []byte("not kdl")},
+	}
+
+	cfg := &includeConfig{}
+	require.NoError(t, NewLoader(WithFS(fsys)).Load(cfg, "etc/app/config.kdl"))
+	require.Equal(t, "db", cfg.Database.Host)
+	require.Equal(t, []includeListener{{Addr: ":80"}}, cfg.Listeners)
+}
+
+func TestLoader_IncludeDirectiveName(t *testing.T) {
+	type config struct {
+		Include string `kdl:"include"`
+		Name    string `kdl:"name"`
+	}
+	fsys := fstest.MapFS{
+		"config.kdl": {Data: []byte("include \"kept\"\nimport \"other.kdl\"\n")},
+		"other.kdl":  {Data: []byte("name \"svc\"\n")},
+	}
+
+	cfg := &config{}
+	require.NoError(t, NewLoader(WithFS(fsys), WithIncludeDirective("import")).Load(cfg, "config.kdl"))
+	require.Equal(t, config{Include: "kept", Name: "svc"}, *cfg)
+
+	// with includes disabled the directive is an ordinary (here unknown) node
+	err := NewLoader(WithFS(fsys), WithIncludeDirective("")).Load(&config{}, "config.kdl")
+	require.ErrorContains(t, err, `unknown node "import"`)
+}
+
+func TestLoader_IncludeNestedDirective(t *testing.T) {
+	type config struct {
+		Name   string `kdl:"name"`
+		Plugin struct {
+			Include []string `kdl:"include"`
+		} `kdl:"plugin"`
+	}
+	fsys := fstest.MapFS{
+		"config.kdl": {Data: []byte("include \"name.kdl\"\nplugin {\n    include \"a\" \"b\"\n}\n")},
+		"name.kdl":   {Data: []byte("name \"svc\"\n")},
+	}
+
+	// only top-level nodes are directives
+	cfg := &config{}
+	require.NoError(t, NewLoader(WithFS(fsys)).Load(cfg, "config.kdl"))
+	require.Equal(t, "svc", cfg.Name)
+	require.Equal(t, []string{"a", "b"}, cfg.Plugin.Include)
+}
+
+func TestLoader_IncludeValueFormats(t *testing.T) {
+	type config struct {
+		Mask  int     `kdl:"mask"`
+		Perm  int     `kdl:"perm"`
+		Ratio float64 `kdl:"ratio"`
+		Size  uint8   `kdl:"size"`
+		Raw   string  `kdl:"raw"`
+	}
+	fsys := fstest.MapFS{
+		"config.kdl": {Data: []byte("include \"values.kdl\"\n")},
+		"values.kdl": {Data: []byte("mask 0xff\nperm 0o755\nratio 1.5e3\nsize (u8)200\n" +
+			"raw r#\"C:\\path \"quoted\"\"#\n")},
+	}
+
+	// the merged document is encoded again before it is unmarshaled; the values must survive
+	cfg := &config{}
+	require.NoError(t, NewLoader(WithFS(fsys)).Load(cfg, "config.kdl"))
+	require.Equal(t, config{
+		Mask:  0xff,
+		Perm:  0o755,
+		Ratio: 1500,
+		Size:  200,
+		Raw:   `C:\path "quoted"`,
+	}, *cfg)
+}
@@ -0,0 +1,435 @@
+// Package kdlpos recovers source positions for the nodes of a KDL document.
+//
+// kdl-go's document model does not record where nodes come from, so Scan walks the raw
+// source a second time and produces a tree that mirrors the parsed document node-for-node
+// (slashdash-commented nodes, arguments, properties and children are skipped exactly
+// like the parser skips them).
+package kdlpos
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Pos is a 1-based line and column in the source. Columns are counted in runes.
+type Pos struct {
+	Line   int
+	Column int
+}
+
+// Node holds the positions of a single KDL node.
+type Node struct {
+	Name string
+	// Pos is the start of the node: its type annotation if present, otherwise its name.
+	Pos Pos
+	// Args holds the position of each argument, in order.
+	Args []Pos
+	// Props maps property names to the position of the property key.
+	Props    map[string]Pos
+	Children []*Node
+}
+
+// Scan returns the position tree of the top-level nodes in data.
+// data is expected to be a document kdl-go has already parsed successfully;
+// Scan only returns an error if it cannot make sense of the input.
+func Scan(data []byte) ([]*Node, error) {
+	s := &scanner{data: data, line: 1, col: 1}
+	return s.nodes(false)
+}
+
+type scanner struct {
+	data []byte
+	off  int
+	line int
+	col  int
+}
+
+func (s *scanner) pos() Pos { return Pos{Line: s.line, Column: s.col} }
+
+func (s *scanner) eof() bool { return s.off >= len(s.data) }
+
+func (s *scanner) peek() rune {
+	if s.eof() {
+		return -1
+	}
+	r, _ := utf8.DecodeRune(s.data[s.off:])
+	return r
+}
+
+func (s *scanner) peekAt(n int) rune {
+	off := s.off
+	for i := 0; i < n; i++ {
+		if off >= len(s.data) {
+			return -1
+		}
+		_, size := utf8.DecodeRune(s.data[off:])
+		off += size
+	}
+	if off >= len(s.data) {
+		return -1
+	}
+	r, _ := utf8.DecodeRune(s.data[off:])
+	return r
+}
+
+func (s *scanner) hasPrefix(p string) bool {
+	return len(s.data)-s.off >= len(p) && string(s.data[s.off:s.off+len(p)]) == p
+}
+
+// next consumes one rune, keeping line and column up to date.
+func (s *scanner) next() rune {
+	r, size := utf8.DecodeRune(s.data[s.off:])
+	s.off += size
+	if isNewline(r) {
+		// treat CRLF as a single line break
+		if r == '\r' && s.peek() == '\n' {
+			s.off++
+		}
+		s.line++
+		s.col = 1
+	} else {
+		s.col++
+	}
+	return r
+}
+
+func (s *scanner) errorf(format string, args ...any) error {
+	return fmt.Errorf("kdlpos: line %d, column %d: %s", s.line, s.col, fmt.Sprintf(format, args...))
+}
+
+// nodes scans a sequence of nodes up to EOF or, when inChildren is set, the closing brace.
+func (s *scanner) nodes(inChildren bool) ([]*Node, error) {
+	var out []*Node
+	for {
+		if err := s.skipLineSpace(); err != nil {
+			return nil, err
+		}
+		if s.eof() {
+			if inChildren {
+				return nil, s.errorf("unexpected end of input in children block")
+			}
+			return out, nil
+		}
+		if s.peek() == '}' {
+			if !inChildren {
+				return nil, s.errorf("unexpected '}'")
+			}
+			s.next()
+			return out, nil
+		}
+
+		discard := false
+		if s.hasPrefix("/-") {
+			s.next()
+			s.next()
+			discard = true
+			if err := s.skipLineSpace(); err != nil {
+				return nil, err
+			}
+		}
+
+		n, err := s.node()
+		if err != nil {
+			return nil, err
+		}
+		if !discard {
+			out = append(out, n)
+		}
+	}
+}
+
+// node scans a single node, including its children block, and its terminator unless that is a '}'.
+func (s *scanner) node() (*Node, error) {
+	n := &Node{Pos: s.pos()}
+	if err := s.skipTypeAnnotation(); err != nil {
+		return nil, err
+	}
+	name, err := s.value()
+	if err != nil {
+		return nil, err
+	}
+	n.Name = name
+
+	for {
+		if err := s.skipNodeSpace(); err != nil {
+			return nil, err
+		}
+		if s.eof() {
+			return n, nil
+		}
+		switch r := s.peek(); {
+		case r == ';' || isNewline(r):
+			s.next()
+			return n, nil
+		case r == '}':
+			return n, nil
+		case s.hasPrefix("//"):
+			s.skipLineComment()
+			return n, nil
+		}
+
+		discard := false
+		if s.hasPrefix("/-") {
+			s.next()
+			s.next()
+			discard = true
+			if err := s.skipNodeSpace(); err != nil {
+				return nil, err
+			}
+		}
+
+		if s.peek() == '{' {
+			s.next()
+			children, err := s.nodes(true)
+			if err != nil {
+				return nil, err
+			}
+			if !discard {
+				n.Children = append(n.Children, children...)
+			}
+			continue
+		}
+
+		start := s.pos()
+		if err := s.skipTypeAnnotation(); err != nil {
+			return nil, err
+		}
+		tok, err := s.value()
+		if err != nil {
+			return nil, err
+		}
+		if s.peek() == '=' {
+			s.next()
+			if err := s.skipTypeAnnotation(); err != nil {
+				return nil, err
+			}
+			if _, err := s.value(); err != nil {
+				return nil, err
+			}
+			if !discard {
+				if n.Props == nil {
+					n.Props = make(map[string]Pos)
+				}
+				n.Props[tok] = start
+			}
+			continue
+		}
+		if !discard {
+			n.Args = append(n.Args, start)
+		}
+	}
+}
+
+// skipTypeAnnotation skips a "(type)" annotation if one starts at the current position.
+func (s *scanner) skipTypeAnnotation() error {
+	if s.peek() != '(' {
+		return nil
+	}
+	s.next()
+	if _, err := s.value(); err != nil {
+		return err
+	}
+	if s.peek() != ')' {
+		return s.errorf("unterminated type annotation")
+	}
+	s.next()
+	return nil
+}
+
+// value scans a quoted string, raw string or bare token and returns its text.
+func (s *scanner) value() (string, error) {
+	switch r := s.peek(); {
+	case r == '"':
+		return s.quoted()
+	case r == 'r' && (s.peekAt(1) == '"' || s.peekAt(1) == '#'):
+		return s.raw()
+	case r == -1 || isDelimiter(r):
+		return "", s.errorf("unexpected %q", r)
+	}
+	start := s.off
+	for !s.eof() && !isDelimiter(s.peek()) {
+		s.next()
+	}
+	return string(s.data[start:s.off]), nil
+}
+
+func (s *scanner) quoted() (string, error) {
+	s.next() // opening quote
+	var b []rune
+	for !s.eof() {
+		r := s.next()
+		switch r {
+		case '"':
+			return string(b), nil
+		case '\\':
+			if s.eof() {
+				return "", s.errorf("unterminated string")
+			}
+			b = append(b, unescape(s.next()))
+		default:
+			b = append(b, r)
+		}
+	}
+	return "", s.errorf("unterminated string")
+}
+
+func (s *scanner) raw() (string, error) {
+	s.next() // r
+	hashes := 0
+	for s.peek() == '#' {
+		s.next()
+		hashes++
+	}
+	if s.peek() != '"' {
+		return "", s.errorf("malformed raw string")
+	}
+	s.next()
+	start := s.off
+	for !s.eof() {
+		end := s.off
+		if s.next() != '"' {
+			continue
+		}
+		n := 0
+		for n < hashes && s.peek() == '#' {
+			s.next()
+			n++
+		}
+		if n == hashes {
+			return string(s.data[start:end]), nil
+		}
+	}
+	return "", s.errorf("unterminated raw string")
+}
+
+// skipNodeSpace skips whitespace, block comments and line continuations, stopping at newlines.
+func (s *scanner) skipNodeSpace() error {
+	for !s.eof() {
+		r := s.peek()
+		switch {
+		case isSpace(r):
+			s.next()
+		case s.hasPrefix("/*"):
+			if err := s.skipBlockComment(); err != nil {
+				return err
+			}
+		case r == '\\':
+			// line continuation: '\' followed by optional whitespace/comment and a newline
+			s.next()
+			for !s.eof() && isSpace(s.peek()) {
+				s.next()
+			}
+			if s.hasPrefix("//") {
+				s.skipLineComment()
+				continue
+			}
+			if !s.eof() && !isNewline(s.peek()) {
+				return s.errorf("expected newline after line continuation")
+			}
+			if !s.eof() {
+				s.next()
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// skipLineSpace skips everything that may appear between nodes: whitespace, newlines,
+// comments and semicolons.
+func (s *scanner) skipLineSpace() error {
+	for !s.eof() {
+		r := s.peek()
+		switch {
+		case isSpace(r) || isNewline(r) || r == ';':
+			s.next()
+		case s.hasPrefix("//"):
+			s.skipLineComment()
+		case s.hasPrefix("/*"):
+			if err := s.skipBlockComment(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// skipLineComment skips a "//" comment together with the newline that ends it.
+func (s *scanner) skipLineComment() {
+	for !s.eof() {
+		if isNewline(s.next()) {
+			return
+		}
+	}
+}
+
+// skipBlockComment skips a possibly nested "/* */" comment.
+func (s *scanner) skipBlockComment() error {
+	depth := 0
+	for !s.eof() {
+		switch {
+		case s.hasPrefix("/*"):
+			s.next()
+			s.next()
+			depth++
+		case s.hasPrefix("*/"):
+			s.next()
+			s.next()
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		default:
+			s.next()
+		}
+	}
+	return s.errorf("unterminated block comment")
+}
+
+func unescape(r rune) rune {
+	switch r {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'f':
+		return '\f'
+	default:
+		// \", \\ and \/ stand for themselves; \u{...} is not decoded
+		return r
+	}
+}
+
+func isNewline(r rune) bool {
+	switch r {
+	case '\n', '\r', '\u0085', '\u000C', '\u2028', '\u2029':
+		return true
+	}
+	return false
+}
+
+func isSpace(r rune) bool {
+	switch r {
+	case '\t', ' ', '\u00A0', '\u1680', '\u202F', '\u205F', '\u3000', '\uFEFF':
+		return true
+	}
+	return r >= '\u2000' && r <= '\u200A'
+}
+
+func isDelimiter(r rune) bool {
+	if isSpace(r) || isNewline(r) {
+		return true
+	}
+	switch r {
+	case '\\', '/', '(', ')', '{', '}', '<', '>', ';', '[', ']', '=', ',', '"':
+		return true
+	}
+	return false
+}
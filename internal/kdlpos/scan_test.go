@@ -0,0 +1,70 @@
+package kdlpos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScan(t *testing.T) {
+	src := "// leading comment\n" +
+		"port 8080\n" +
+		"/-disabled 1 {\n" +
+		"\tchild 2\n" +
+		"}\n" +
+		"database host=\"db\" /-skipped=1 {\n" +
+		"\t(t)primary {\n" +
+		"\t\tport 5432; user r#\"a \"quoted\" name\"#\n" +
+		"\t}\n" +
+		"\t/* block /* nested */ */ replica \\\n" +
+		"\t\t\"x\"\n" +
+		"}\n" +
+		"\"quoted name\" 1 /-2 3 /-{\n" +
+		"\tignored 1\n" +
+		"}\n"
+
+	nodes, err := Scan([]byte(src))
+	require.NoError(t, err)
+	require.Len(t, nodes, 3)
+
+	port := nodes[0]
+	require.Equal(t, "port", port.Name)
+	require.Equal(t, Pos{Line: 2, Column: 1}, port.Pos)
+	require.Equal(t, []Pos{{Line: 2, Column: 6}}, port.Args)
+
+	db := nodes[1]
+	require.Equal(t, "database", db.Name)
+	require.Equal(t, Pos{Line: 6, Column: 1}, db.Pos)
+	require.Equal(t, map[string]Pos{"host": {Line: 6, Column: 10}}, db.Props)
+	require.Len(t, db.Children, 2)
+
+	primary := db.Children[0]
+	require.Equal(t, "primary", primary.Name)
+	require.Equal(t, Pos{Line: 7, Column: 2}, primary.Pos)
+	require.Len(t, primary.Children, 2)
+	require.Equal(t, Pos{Line: 8, Column: 3}, primary.Children[0].Pos)
+	require.Equal(t, "user", primary.Children[1].Name)
+	require.Equal(t, Pos{Line: 8, Column: 14}, primary.Children[1].Pos)
+
+	replica := db.Children[1]
+	require.Equal(t, "replica", replica.Name)
+	require.Equal(t, Pos{Line: 10, Column: 27}, replica.Pos)
+	require.Equal(t, []Pos{{Line: 11, Column: 3}}, replica.Args)
+
+	quoted := nodes[2]
+	require.Equal(t, "quoted name", quoted.Name)
+	require.Len(t, quoted.Args, 2)
+	require.Empty(t, quoted.Children)
+}
+
+func TestScan_Errors(t *testing.T) {
+	for _, src := range []string{
+		"node {\n",
+		"}\n",
+		"node \"unterminated\n",
+		"/* open\n",
+	} {
+		_, err := Scan([]byte(src))
+		require.Error(t, err, "expected error for %q", src)
+	}
+}
@@ -0,0 +1,87 @@
+package kdlconfig
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sblinch/kdl-go/document"
+)
+
+// LoadLayered reads the config files at paths, merges them in order and loads the result
+// into cfg like Load, so that a base config can be refined by environment-specific and
+// local files:
+//
+//	err := loader.LoadLayered(cfg, "base.kdl", "prod.kdl", "local.kdl")
+//
+// Each file has its include directives resolved on its own. Nodes of later files are
+// merged into those of earlier ones: arguments replace earlier arguments, properties and
+// children are merged recursively, and the occurrences of a `,multiple` node in a later
+// file replace all earlier ones. Lists of a field tagged `merge:"append"` are appended to
+// instead of replaced.
+//
+// Strict checking, defaults, environment overrides and validation apply to the merged
+// document only, so an individual file need not be complete. Errors point into the file
+// the offending value was read from.
+func (l *Loader) LoadLayered(cfg interface{}, paths ...string) error {
+	_, err := l.loadLayered(cfg, paths)
+	return err
+}
+
+// loadLayered loads the files at paths into cfg and returns the merged source.
+func (l *Loader) loadLayered(cfg any, paths []string) (*source, error) {
+	return l.loadMerged(cfg, paths, true)
+}
+
+// loadFragments is like loadLayered, but merges the files as if each was included in
+// turn: the occurrences of a `,multiple` node are kept from every file. It is used for
+// conf.d-style directories, whose files are peers rather than layers.
+func (l *Loader) loadFragments(cfg any, paths []string) (*source, error) {
+	return l.loadMerged(cfg, paths, false)
+}
+
+// loadMerged loads the files at paths into cfg and returns the merged source. With
+// layered set, later files replace the `,multiple` nodes of earlier ones.
+func (l *Loader) loadMerged(cfg any, paths []string, layered bool) (*source, error) {
+	switch len(paths) {
+	case 0:
+		return nil, errors.New("no config files to load")
+	case 1:
+		return l.loadFile(cfg, paths[0])
+	}
+
+	// the merged document has no name of its own: every position points into its layer
+	merged := &source{doc: document.New(), pos: make(positions), layers: paths}
+	var layers nodeLayers
+	if layered {
+		layers = make(nodeLayers)
+	}
+	for i, p := range paths {
+		data, err := l.readFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file %q: %w", p, err)
+		}
+		src, err := l.parse(cfg, data, p)
+		if err != nil {
+			return nil, err
+		}
+		if layers != nil {
+			layers.add(src.doc.Nodes, i)
+		}
+		merged.doc.Nodes = append(merged.doc.Nodes, src.doc.Nodes...)
+		for n, np := range src.pos {
+			merged.pos[n] = np
+		}
+		merged.includes = append(merged.includes, src.includes...)
+	}
+	merged.doc.Nodes = mergeNodes(cfg, merged.doc.Nodes, merged.pos, layers)
+	if layered {
+		l.log().Debug("merged config layers", "files", paths)
+	} else {
+		l.log().Debug("merged config fragments", "files", paths)
+	}
+
+	if err := l.decode(cfg, merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
@@ -0,0 +1,104 @@
+package kdlconfig
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type layeredConfig struct {
+	Name     string `kdl:"name" validate:"required"`
+	Database struct {
+		Host    string `kdl:"host"`
+		Port    int    `kdl:"port" validate:"max=65535"`
+		Options struct {
+			SSL     bool `kdl:"ssl"`
+			Timeout int  `kdl:"timeout"`
+		} `kdl:"options"`
+	} `kdl:"database"`
+	Listeners []includeListener `kdl:"listener,multiple"`
+	Plugins   []includeListener `kdl:"plugin,multiple" merge:"append"`
+	Tags      []string          `kdl:"tags"`
+	Features  []string          `kdl:"features" merge:"append"`
+	Limits    map[string]int    `kdl:"limits"`
+}
+
+func TestLoader_LoadLayered(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base.kdl": "name \"svc\"\n" +
+			"database {\n    host \"localhost\"\n    port 5432\n    options ssl=false {\n        timeout 5\n    }\n}\n" +
+			"listener addr=\":80\"\nlistener addr=\":81\"\n" +
+			"plugin addr=\"auth\"\n" +
+			"tags \"a\" \"b\"\nfeatures \"x\"\n" +
+			"limits {\n    rps 10\n    burst 20\n}\n",
+		"prod.kdl": "database {\n    host \"db.prod\"\n    options {\n        ssl true\n    }\n}\n" +
+			"listener addr=\":443\" tls=true\n" +
+			"plugin addr=\"metrics\"\n" +
+			"tags \"c\"\nfeatures \"y\" \"z\"\n" +
+			"limits {\n    rps 100\n}\n",
+		"local.kdl": "database {\n    port 6543\n}\n",
+	})
+
+	cfg := &layeredConfig{}
+	err := NewLoader().LoadLayered(cfg,
+		filepath.Join(dir, "base.kdl"), filepath.Join(dir, "prod.kdl"), filepath.Join(dir, "local.kdl"))
+	require.NoError(t, err)
+
+	require.Equal(t, "svc", cfg.Name)
+	require.Equal(t, "db.prod", cfg.Database.Host)
+	require.Equal(t, 6543, cfg.Database.Port)
+	require.True(t, cfg.Database.Options.SSL)
+	require.Equal(t, 5, cfg.Database.Options.Timeout)
+	// later layers replace `,multiple` nodes and lists unless they are tagged to append
+	require.Equal(t, []includeListener{{Addr: ":443", TLS: true}}, cfg.Listeners)
+	require.Equal(t, []includeListener{{Addr: "auth"}, {Addr: "metrics"}}, cfg.Plugins)
+	require.Equal(t, []string{"c"}, cfg.Tags)
+	require.Equal(t, []string{"x", "y", "z"}, cfg.Features)
+	require.Equal(t, map[string]int{"rps": 100, "burst": 20}, cfg.Limits)
+}
+
+func TestLoader_LoadLayered_ValidatesMergedResult(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		// incomplete on its own: name is required
+		"base.kdl":  "database {\n    port 5432\n}\n",
+		"name.kdl":  "name \"svc\"\n",
+		"ports.kdl": "database {\n    port 70000\n}\n",
+	})
+	base, name, ports := filepath.Join(dir, "base.kdl"), filepath.Join(dir, "name.kdl"), filepath.Join(dir, "ports.kdl")
+
+	require.NoError(t, NewLoader().LoadLayered(&layeredConfig{}, base, name))
+
+	err := NewLoader().LoadLayered(&layeredConfig{}, base, name, ports)
+	require.Error(t, err)
+	verrs, ok := err.(ValidationErrors)
+	require.True(t, ok, "expected ValidationErrors, got %T", err)
+	require.Len(t, verrs, 1)
+	require.Equal(t, "database.port", verrs[0].Path)
+	// the error points into the layer that set the value
+	require.Equal(t, Position{File: ports, Line: 2, Column: 10}, verrs[0].Pos)
+}
+
+func TestLoader_LoadLayered_StrictAndIncludes(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base.kdl":     "name \"svc\"\ninclude \"conf/db.kdl\"\n",
+		"conf/db.kdl":  "database {\n    host \"db\"\n}\n",
+		"override.kdl": "database {\n    prot 1\n}\n",
+	})
+
+	err := NewLoader().LoadLayered(&layeredConfig{}, filepath.Join(dir, "base.kdl"), filepath.Join(dir, "override.kdl"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "override.kdl:2:5")
+	require.Contains(t, err.Error(), `did you mean "port"?`)
+
+	cfg := &layeredConfig{}
+	require.NoError(t, NewLoader(WithStrict(false)).LoadLayered(cfg, filepath.Join(dir, "base.kdl"), filepath.Join(dir, "override.kdl")))
+	require.Equal(t, "db", cfg.Database.Host)
+}
+
+func TestLoader_LoadLayered_Errors(t *testing.T) {
+	require.Error(t, NewLoader().LoadLayered(&layeredConfig{}))
+
+	path := writeConfig(t, "name \"svc\"\n")
+	require.Error(t, NewLoader().LoadLayered(&layeredConfig{}, path, filepath.Join(t.TempDir(), "missing.kdl")))
+}
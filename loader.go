@@ -1,7 +1,10 @@
 package kdlconfig
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 
 	"github.com/sblinch/kdl-go"
@@ -9,31 +12,182 @@ import (
 
 // Loader is responsible for reading, parsing and validating KDL configs into Go structures.
 // First, kdl.Unmarshal is used to parse and map the data,
+// then defaults declared with `default` tags are filled in, environment variable
+// overrides (see WithEnvPrefix) and explicit ones (see WithOverride) are applied,
 // then validation is performed using struct tags (`min`, `max`, `required`, etc.).
-type Loader struct{}
+//
+// Before unmarshaling, `include "path/*.kdl"` directives are replaced with the nodes of
+// the files they name (see WithIncludeDirective).
+//
+// A Loader is configured with Options when it is created and is safe for concurrent use.
+// The zero value loads with the default settings.
+type Loader struct {
+	env          bool
+	envPrefix    string
+	lenient      bool
+	skipDefaults bool
+	fsys         fs.FS
+	logger       Logger
+	validator    validator
 
-// NewLoader creates a new Loader instance.
-func NewLoader() *Loader {
-	return &Loader{}
+	include         string
+	noInclude       bool
+	maxIncludeDepth int
+
+	// overrides maps KDL paths to the values set with WithOverride.
+	overrides map[string]string
+}
+
+// NewLoader creates a new Loader instance configured with opts.
+func NewLoader(opts ...Option) *Loader {
+	l := &Loader{}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
 // Load reads the config file at path, unmarshals it using kdl.Unmarshal
-// into the provided Go structure cfg (pointer), then performs validation.
+// into the provided Go structure cfg (pointer), applies `default` tags to the
+// fields absent from the file, then performs validation.
+// The file is read from the Loader's fs.FS if one was set with WithFS.
+//
+// Unmarshal failures are returned as *UnmarshalError and validation failures as
+// ValidationErrors; both carry the position in the file the problem was found at.
 func (l *Loader) Load(cfg interface{}, path string) error {
-	// Reading the file
-	data, err := os.ReadFile(path)
+	_, err := l.loadFile(cfg, path)
+	return err
+}
+
+// LoadReader reads a KDL document from r and loads it into cfg like Load.
+// name identifies the document in error messages and positions; it may be empty.
+func (l *Loader) LoadReader(cfg interface{}, r io.Reader, name string) error {
+	data, err := io.ReadAll(r)
 	if err != nil {
-		return fmt.Errorf("failed to read config file %q: %w", path, err)
+		return fmt.Errorf("failed to read config %q: %w", name, err)
 	}
+	return l.LoadBytes(cfg, data, name)
+}
+
+// LoadBytes loads the KDL document data into cfg like Load.
+// name identifies the document in error messages and positions; it may be empty.
+// Include directives are resolved relative to the directory of name.
+func (l *Loader) LoadBytes(cfg interface{}, data []byte, name string) error {
+	_, err := l.load(cfg, data, name)
+	return err
+}
 
-	// Unmarshaling via kdl.Unmarshal: checks KDL syntax correctness
-	if err := kdl.Unmarshal(data, cfg); err != nil {
-		return fmt.Errorf("failed to unmarshal KDL: %w", err)
+// loadFile loads the file at path into cfg and returns the source it was read from.
+func (l *Loader) loadFile(cfg any, path string) (*source, error) {
+	data, err := l.readFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %q: %w", path, err)
 	}
+	return l.load(cfg, data, path)
+}
 
-	// Validation using struct tags (min, max, required, etc.)
-	if err := validateStruct(cfg); err != nil {
+// load does the work of LoadBytes, returning the resolved source on success.
+func (l *Loader) load(cfg any, data []byte, name string) (*source, error) {
+	src, err := l.parse(cfg, data, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.decode(cfg, src); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// parse parses data and resolves its include directives.
+func (l *Loader) parse(cfg any, data []byte, name string) (*source, error) {
+	// Parsing keeps the document around so that errors can point at the offending node
+	src, err := parseSource(name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Include directives splice other files into the document
+	if err := l.resolveIncludes(cfg, src); err != nil {
+		return nil, err
+	}
+	if len(src.includes) > 0 {
+		l.log().Debug("resolved includes", "name", name, "files", src.includes)
+	}
+	return src, nil
+}
+
+// decode unmarshals the resolved document src into cfg, applies defaults and
+// environment overrides, and validates the result.
+func (l *Loader) decode(cfg any, src *source) error {
+	// Strict mode reports every node, argument and property the struct has no field for
+	if !l.lenient {
+		if errs := src.checkStrict(cfg); len(errs) > 0 {
+			return errs
+		}
+	}
+
+	// Unmarshaling via the kdl decoder: maps the nodes onto the struct fields
+	encoded, err := src.encode()
+	if err != nil {
 		return err
 	}
+	if err := l.unmarshal(encoded, cfg); err != nil {
+		return src.unmarshalError(err)
+	}
+
+	// Defaults from `default` tags fill in the fields the document left out
+	if !l.skipDefaults {
+		if src.defaults, err = applyDefaults(cfg, src.doc); err != nil {
+			return err
+		}
+	}
+
+	// Environment variables override both the file and the defaults
+	if l.env {
+		if src.env, err = applyEnv(cfg, l.envPrefix); err != nil {
+			return err
+		}
+		for path, variable := range src.env {
+			l.log().Debug("applied environment override", "path", path, "var", variable)
+		}
+	}
+
+	// Overrides set through WithOverride take precedence over everything else
+	if len(l.overrides) > 0 {
+		if err := applyOverrides(cfg, l.overrides); err != nil {
+			return err
+		}
+	}
+
+	// Validation using struct tags (min, max, required, etc.)
+	if err := l.validator.validateStruct(cfg); err != nil {
+		return src.env.annotate(src.annotate(err))
+	}
+
+	l.log().Debug("config loaded", "name", src.name)
 	return nil
 }
+
+func (l *Loader) readFile(path string) ([]byte, error) {
+	if l.fsys != nil {
+		return fs.ReadFile(l.fsys, path)
+	}
+	return os.ReadFile(path)
+}
+
+// unmarshal decodes data into cfg, ignoring unknown nodes, arguments and properties
+// unless the Loader is strict.
+func (l *Loader) unmarshal(data []byte, cfg any) error {
+	dec := kdl.NewDecoder(bytes.NewReader(data))
+	dec.Options.AllowUnhandledNodes = l.lenient
+	dec.Options.AllowUnhandledArgs = l.lenient
+	dec.Options.AllowUnhandledProps = l.lenient
+	return dec.Decode(cfg)
+}
+
+func (l *Loader) log() Logger {
+	if l.logger == nil {
+		return nopLogger{}
+	}
+	return l.logger
+}
@@ -1,8 +1,16 @@
 package kdlconfig
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"testing/iotest"
+
+	"github.com/sblinch/kdl-go"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoader_Load(t *testing.T) {
@@ -65,3 +73,230 @@ func TestLoader_Load(t *testing.T) {
 		})
 	}
 }
+
+type positionConfig struct {
+	Name     string `kdl:"name"`
+	Database struct {
+		Host string `kdl:"host" validate:"required"`
+		Port int    `kdl:"port" validate:"max=65535"`
+	} `kdl:"database"`
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoader_Load_ValidationPositions(t *testing.T) {
+	path := writeConfig(t, "name \"svc\"\n\ndatabase {\n    port 70000\n}\n")
+
+	err := NewLoader().Load(&positionConfig{}, path)
+	require.Error(t, err)
+
+	verrs, ok := err.(ValidationErrors)
+	require.True(t, ok, "expected ValidationErrors, got %T", err)
+	require.Len(t, verrs, 2)
+
+	// host is absent: the error points at the enclosing database node
+	require.Equal(t, "database.host", verrs[0].Path)
+	require.Equal(t, Position{File: path, Line: 3, Column: 1}, verrs[0].Pos)
+
+	require.Equal(t, "database.port", verrs[1].Path)
+	// the error points at the offending value
+	require.Equal(t, Position{File: path, Line: 4, Column: 10}, verrs[1].Pos)
+	require.Equal(t, path+":4:10: database.port: value 70000 > max 65535", verrs[1].Error())
+}
+
+func TestLoader_Load_UnmarshalPositions(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantLine int
+	}{
+		{
+			name:     "missing argument",
+			content:  "name \"svc\"\ndatabase {\n    host \"db\"\n    port\n}\n",
+			wantLine: 4,
+		},
+		{
+			name:     "syntax error",
+			content:  "name \"svc\"\nport 1 }\n",
+			wantLine: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.content)
+			err := NewLoader().Load(&positionConfig{}, path)
+			require.Error(t, err)
+
+			var uerr *UnmarshalError
+			require.True(t, errors.As(err, &uerr), "expected UnmarshalError, got %T", err)
+			require.Equal(t, path, uerr.Pos.File)
+			require.Equal(t, tt.wantLine, uerr.Pos.Line)
+		})
+	}
+}
+
+func TestLoader_Load_CollectionPositions(t *testing.T) {
+	type listener struct {
+		Addr string `kdl:"addr" validate:"required"`
+	}
+	type config struct {
+		Listeners []listener `kdl:"listener,multiple"`
+	}
+	path := writeConfig(t, "listener addr=\":80\"\nlistener addr=\"\"\n")
+
+	err := NewLoader().Load(&config{}, path)
+	require.Error(t, err)
+
+	verrs, ok := err.(ValidationErrors)
+	require.True(t, ok, "expected ValidationErrors, got %T", err)
+	require.Len(t, verrs, 1)
+	require.Equal(t, "listener[1].addr", verrs[0].Path)
+	require.Equal(t, Position{File: path, Line: 2, Column: 10}, verrs[0].Pos)
+}
+
+func TestLoader_Load_Defaults(t *testing.T) {
+	type config struct {
+		Port int    `kdl:"port" default:"8080" validate:"required,max=65535"`
+		Name string `kdl:"name" default:"svc"`
+	}
+	path := writeConfig(t, "name \"api\"\n")
+
+	cfg := &config{}
+	require.NoError(t, NewLoader().Load(cfg, path))
+	require.Equal(t, 8080, cfg.Port)
+	require.Equal(t, "api", cfg.Name)
+}
+
+func TestLoader_Load_EnvOverrides(t *testing.T) {
+	type config struct {
+		Port int    `kdl:"port" validate:"max=65535"`
+		Name string `kdl:"name" default:"svc"`
+	}
+	path := writeConfig(t, "port 8080\n")
+
+	t.Setenv("APP_NAME", "api")
+	t.Setenv("APP_PORT", "9090")
+	cfg := &config{}
+	require.NoError(t, NewLoader(WithEnvPrefix("APP")).Load(cfg, path))
+	require.Equal(t, 9090, cfg.Port)
+	require.Equal(t, "api", cfg.Name)
+
+	// env-supplied values are validated like file values
+	t.Setenv("APP_PORT", "70000")
+	err := NewLoader(WithEnvPrefix("APP")).Load(&config{}, path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "value 70000 > max 65535 (from environment variable APP_PORT)")
+
+	// without the option the environment is ignored
+	cfg = &config{}
+	require.NoError(t, NewLoader().Load(cfg, path))
+	require.Equal(t, 8080, cfg.Port)
+}
+
+func TestLoader_LoadBytes(t *testing.T) {
+	cfg := &positionConfig{}
+	err := NewLoader().LoadBytes(cfg, []byte("name \"svc\"\ndatabase {\n    host \"db\"\n    port 5432\n}\n"), "inline.kdl")
+	require.NoError(t, err)
+	require.Equal(t, "db", cfg.Database.Host)
+	require.Equal(t, 5432, cfg.Database.Port)
+
+	// the name is used in positions and error messages
+	err = NewLoader().LoadBytes(&positionConfig{}, []byte("name \"svc\"\ndatabase {\n    port 70000\n}\n"), "inline.kdl")
+	verrs, ok := err.(ValidationErrors)
+	require.True(t, ok, "expected ValidationErrors, got %T", err)
+	require.Equal(t, Position{File: "inline.kdl", Line: 3, Column: 10}, verrs[1].Pos)
+	require.Contains(t, err.Error(), "inline.kdl:3:10: database.port")
+
+	// without a name only line and column are reported
+	err = NewLoader().LoadBytes(&positionConfig{}, []byte("name \"svc\"\ndatabase {\n    port 70000\n}\n"), "")
+	require.Contains(t, err.Error(), "3:10: database.port")
+}
+
+func TestLoader_LoadReader(t *testing.T) {
+	cfg := &positionConfig{}
+	r := strings.NewReader("name \"svc\"\ndatabase {\n    host \"db\"\n}\n")
+	require.NoError(t, NewLoader().LoadReader(cfg, r, "secret://app"))
+	require.Equal(t, "svc", cfg.Name)
+
+	err := NewLoader().LoadReader(&positionConfig{}, strings.NewReader("name \"svc\"\ndatabase {\n    port\n}\n"), "secret://app")
+	var uerr *UnmarshalError
+	require.True(t, errors.As(err, &uerr), "expected UnmarshalError, got %T", err)
+	require.Equal(t, Position{File: "secret://app", Line: 3, Column: 5}, uerr.Pos)
+
+	readErr := errors.New("connection reset")
+	err = NewLoader().LoadReader(&positionConfig{}, iotest.ErrReader(readErr), "secret://app")
+	require.ErrorIs(t, err, readErr)
+	require.Contains(t, err.Error(), `"secret://app"`)
+}
+
+func TestLoader_Load_Strict(t *testing.T) {
+	type config struct {
+		Port int `kdl:"port" default:"8080"`
+	}
+	path := writeConfig(t, "prot 9090\n")
+
+	err := NewLoader().Load(&config{}, path)
+	verrs, ok := err.(ValidationErrors)
+	require.True(t, ok, "expected ValidationErrors, got %T", err)
+	require.Len(t, verrs, 1)
+	require.Equal(t, path+`:1:1: prot: unknown node "prot", did you mean "port"?`, verrs[0].Error())
+
+	// lenient loaders ignore the typo and fall back to the default
+	cfg := &config{}
+	require.NoError(t, NewLoader(WithStrict(false)).Load(cfg, path))
+	require.Equal(t, 8080, cfg.Port)
+}
+
+func TestKDLGoErrorWording(t *testing.T) {
+	_, err := kdl.Parse(strings.NewReader("name \"svc\"\nport 1 }\n"))
+	require.Error(t, err)
+	require.Regexp(t, parseErrorRe, err.Error())
+	pos := parseErrorPosition("c.kdl", err)
+	require.Equal(t, "c.kdl", pos.File)
+	require.Equal(t, 2, pos.Line)
+	require.NotZero(t, pos.Column)
+
+	tests := []struct {
+		name    string
+		content string
+		re      *regexp.Regexp
+		want    Position
+	}{
+		{
+			name:    "missing argument",
+			content: "name \"svc\"\ndatabase {\n    port\n}\n",
+			re:      leadingNodeRe,
+			want:    Position{File: "c.kdl", Line: 3, Column: 5},
+		},
+		{
+			name:    "unexpected arguments",
+			content: "name \"svc\"\ndatabase 1\n",
+			re:      leadingNodeRe,
+			want:    Position{File: "c.kdl", Line: 2, Column: 1},
+		},
+		{
+			name:    "unknown node",
+			content: "name \"svc\"\nport 1\n",
+			re:      quotedNodeRe,
+			want:    Position{File: "c.kdl", Line: 2, Column: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := parseSource("c.kdl", []byte(tt.content))
+			require.NoError(t, err)
+			err = kdl.Unmarshal([]byte(tt.content), &positionConfig{})
+			require.Error(t, err)
+			require.Regexp(t, tt.re, err.Error())
+
+			var uerr *UnmarshalError
+			require.True(t, errors.As(src.unmarshalError(err), &uerr))
+			require.Equal(t, tt.want, uerr.Pos)
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package kdlconfig
+
+// Logger receives diagnostic messages from Loader and Watcher.
+// Arguments are alternating key/value pairs; *slog.Logger satisfies the interface.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// nopLogger discards everything; it is used when no Logger is configured.
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
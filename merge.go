@@ -0,0 +1,204 @@
+package kdlconfig
+
+import (
+	"reflect"
+
+	"github.com/sblinch/kdl-go/document"
+)
+
+// mergeNodes merges the nodes that map onto the same field of the struct cfg points to,
+// so that a node repeated at the same level (typically because it is spread over several
+// files) behaves like a single node:
+//
+//   - arguments of a later node replace those of an earlier one,
+//   - properties are merged, later values winning,
+//   - children are merged recursively by the same rules.
+//
+// Nodes unmarshaled into `,multiple` fields are kept as they are, as are nodes that do
+// not map onto any field. Merged nodes stay at the position of their first occurrence;
+// the positions of replaced arguments and properties are updated in pos.
+//
+// A field tagged `merge:"append"` collects lists instead of replacing them: the arguments
+// (or, for slices written as child nodes, the children) of later nodes are appended.
+//
+// layers, if not nil, tells which document of a LoadLayered stack each node comes from.
+// Across layers the occurrences of a `,multiple` node are replaced as a whole: only those
+// of the last layer that has any are kept, unless the field is tagged `merge:"append"`.
+func mergeNodes(cfg any, nodes []*document.Node, pos positions, layers nodeLayers) []*document.Node {
+	t := indirectType(reflect.TypeOf(cfg))
+	if t.Kind() != reflect.Struct {
+		return nodes
+	}
+	m := &merger{pos: pos, layers: layers}
+	return m.structNodes(t, nodes)
+}
+
+// nodeLayers maps the nodes of a layered document to the index of the layer they were read from.
+type nodeLayers map[*document.Node]int
+
+// add records that nodes and their descendants belong to layer.
+func (l nodeLayers) add(nodes []*document.Node, layer int) {
+	for _, n := range nodes {
+		l[n] = layer
+		l.add(n.Children, layer)
+	}
+}
+
+type merger struct {
+	pos    positions
+	layers nodeLayers
+}
+
+// mergeRule describes how the nodes mapping onto one field are merged.
+type mergeRule struct {
+	// t is the type a single node is unmarshaled into, nil if unknown.
+	t reflect.Type
+	// combine merges every occurrence into the first one.
+	combine bool
+	// replace keeps only the occurrences from the last layer (`,multiple` fields).
+	replace bool
+	// append appends the list of a later node to that of an earlier one.
+	append bool
+}
+
+// structNodes merges nodes, the children of a node unmarshaled into struct type t.
+func (m *merger) structNodes(t reflect.Type, nodes []*document.Node) []*document.Node {
+	fields, _ := strictFields(t)
+	return m.merge(nodes, func(name string) mergeRule {
+		f, ok := fields[name]
+		if !ok {
+			return mergeRule{}
+		}
+		appendList := f.Tag.Get("merge") == "append"
+		if hasAttr(f.attrs, "multiple") {
+			// every occurrence is an element of its own
+			r := mergeRule{replace: !appendList}
+			if ft := indirectType(f.Type); ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array {
+				r.t = ft.Elem()
+			}
+			return r
+		}
+		return mergeRule{t: f.Type, combine: true, append: appendList}
+	})
+}
+
+// merge merges the nodes according to the rule field returns for their name, then
+// descends into the children of every node whose type is known.
+func (m *merger) merge(nodes []*document.Node, field func(name string) mergeRule) []*document.Node {
+	// the last layer each replaced node occurs in
+	last := make(map[string]int)
+	if m.layers != nil {
+		for _, n := range nodes {
+			name := n.Name.ValueString()
+			if l := m.layers[n]; field(name).replace && l > last[name] {
+				last[name] = l
+			}
+		}
+	}
+
+	out := make([]*document.Node, 0, len(nodes))
+	first := make(map[string]*document.Node)
+	for _, n := range nodes {
+		name := n.Name.ValueString()
+		r := field(name)
+		if r.replace && m.layers[n] < last[name] {
+			continue
+		}
+		if r.combine {
+			if dst, ok := first[name]; ok {
+				m.mergeNode(dst, n, r)
+				continue
+			}
+			first[name] = n
+		}
+		out = append(out, n)
+	}
+	for _, n := range out {
+		if r := field(n.Name.ValueString()); r.t != nil {
+			m.children(r.t, n)
+		}
+	}
+	return out
+}
+
+// children merges the children of n, which is unmarshaled into a value of type t.
+func (m *merger) children(t reflect.Type, n *document.Node) {
+	t = indirectType(t)
+	switch t.Kind() {
+	case reflect.Struct:
+		fields, _ := strictFields(t)
+		if f, ok := withAttr(fields, "children"); ok {
+			n.Children = m.childNodes(f.Type, n.Children)
+			return
+		}
+		n.Children = m.structNodes(t, n.Children)
+	case reflect.Map:
+		n.Children = m.mapNodes(t, n.Children)
+	}
+}
+
+// childNodes merges the nodes captured by a `,children` field of type t.
+func (m *merger) childNodes(t reflect.Type, nodes []*document.Node) []*document.Node {
+	switch t = indirectType(t); t.Kind() {
+	case reflect.Struct:
+		return m.structNodes(t, nodes)
+	case reflect.Map:
+		return m.mapNodes(t, nodes)
+	}
+	return nodes
+}
+
+// mapNodes merges nodes, the entries of map type t keyed by node name.
+func (m *merger) mapNodes(t reflect.Type, nodes []*document.Node) []*document.Node {
+	return m.merge(nodes, func(string) mergeRule {
+		return mergeRule{t: t.Elem(), combine: true}
+	})
+}
+
+// mergeNode merges src into dst following r; the children are merged later by children.
+func (m *merger) mergeNode(dst, src *document.Node, r mergeRule) {
+	dp, sp := m.pos[dst], m.pos[src]
+	if dp == nil {
+		dp = &nodePosition{}
+		m.pos[dst] = dp
+	}
+
+	switch {
+	case len(src.Arguments) == 0:
+	case r.append:
+		dst.Arguments = append(append([]*document.Value(nil), dst.Arguments...), src.Arguments...)
+		if sp != nil {
+			dp.args = append(append([]Position(nil), dp.args...), sp.args...)
+		}
+	default:
+		dst.Arguments = src.Arguments
+		if sp != nil {
+			dp.Position = sp.Position
+			dp.args = sp.args
+		}
+	}
+
+	for name, v := range src.Properties.Unordered() {
+		if !dst.Properties.Allocated() {
+			dst.Properties.Alloc()
+		}
+		dst.Properties.Add(name, v)
+		if sp != nil {
+			if p, ok := sp.props[name]; ok {
+				if dp.props == nil {
+					dp.props = make(map[string]Position)
+				}
+				dp.props[name] = p
+			}
+		}
+	}
+
+	// a slice written as child nodes is a list like any other
+	if r.t != nil && !r.append && len(src.Children) > 0 {
+		if k := indirectType(r.t).Kind(); k == reflect.Slice || k == reflect.Array {
+			dst.Children = src.Children
+			return
+		}
+	}
+	dst.Children = append(dst.Children, src.Children...)
+}
@@ -0,0 +1,124 @@
+package kdlconfig
+
+import (
+	"io/fs"
+
+	"github.com/ykhdr/kdl-config/rules"
+)
+
+// Option configures a Loader.
+type Option func(*Loader)
+
+// WithEnvPrefix enables environment variable overrides, applied after the file and its
+// defaults and before validation.
+//
+// A field is overridden by the variable named after its KDL path, upper-cased, with dots
+// and dashes replaced by underscores and prefix prepended: with prefix "APP" the field
+// at database.primary.port is read from APP_DATABASE_PRIMARY_PORT. An `env:"NAME"` tag
+// sets the variable name explicitly (without prefix) and `env:"-"` opts a field out.
+// An empty prefix enables only the fields with an explicit `env` tag.
+func WithEnvPrefix(prefix string) Option {
+	return func(l *Loader) {
+		l.env = true
+		l.envPrefix = prefix
+	}
+}
+
+// WithOverride sets the field at the KDL path (e.g. "database.primary.port") to value,
+// overriding the file, its defaults and the environment. The value is parsed like an
+// environment variable (see WithEnvPrefix). Loading fails if no field has that path.
+// Use it for command-line flags and other settings decided by the program itself.
+func WithOverride(path, value string) Option {
+	return func(l *Loader) {
+		if l.overrides == nil {
+			l.overrides = make(map[string]string)
+		}
+		l.overrides[path] = value
+	}
+}
+
+// WithRegistry makes the Loader resolve validation rules in registry instead of
+// rules.DefaultRegistry(). Use rules.NewRegistry or Clone to create one.
+func WithRegistry(registry *rules.Registry) Option {
+	return func(l *Loader) {
+		l.validator.registry = registry
+	}
+}
+
+// WithRule registers a validation rule for this Loader only. It takes precedence over
+// a rule of the same name in the Loader's registry.
+func WithRule(name string, factory rules.RuleFactory) Option {
+	return func(l *Loader) {
+		if l.validator.rules == nil {
+			l.validator.rules = make(map[string]rules.RuleFactory)
+		}
+		l.validator.rules[name] = factory
+	}
+}
+
+// WithStrict controls whether nodes, arguments and properties that do not map onto a
+// struct field are rejected (the default) or silently ignored.
+//
+// In strict mode the whole document is checked before it is unmarshaled and every
+// offender is reported in the returned ValidationErrors, with its position and a
+// "did you mean" suggestion when a field with a similar name exists.
+func WithStrict(enabled bool) Option {
+	return func(l *Loader) {
+		l.lenient = !enabled
+	}
+}
+
+// WithDefaults controls whether `default` struct tags are applied (the default).
+func WithDefaults(enabled bool) Option {
+	return func(l *Loader) {
+		l.skipDefaults = !enabled
+	}
+}
+
+// WithFS makes the Loader read config files from fsys instead of the operating system.
+// Paths passed to Load must then be valid fs.FS paths (slash-separated, unrooted).
+func WithFS(fsys fs.FS) Option {
+	return func(l *Loader) {
+		l.fsys = fsys
+	}
+}
+
+// WithLogger sets the Logger the Loader reports its progress to. Nothing is logged by default.
+func WithLogger(logger Logger) Option {
+	return func(l *Loader) {
+		l.logger = logger
+	}
+}
+
+// WithTagName sets the struct tag validation rules are read from; the default is "validate".
+func WithTagName(name string) Option {
+	return func(l *Loader) {
+		l.validator.tagName = name
+	}
+}
+
+// WithIncludeDirective sets the node name that includes other files, "include" by default.
+// An empty name turns includes off, leaving such nodes to be unmarshaled like any other.
+//
+//	include "listeners/*.kdl"
+//
+// The directive is only recognized at the top level of a file; a node of that name
+// inside another node is unmarshaled like any other. Patterns are resolved relative to
+// the including file and may be globs; the files they match are spliced in, in lexical
+// order, where the directive appears. Nodes repeated across files are merged: arguments
+// are replaced, properties and children merged recursively, and every occurrence of a
+// `,multiple` node is kept.
+func WithIncludeDirective(name string) Option {
+	return func(l *Loader) {
+		l.include = name
+		l.noInclude = name == ""
+	}
+}
+
+// WithMaxIncludeDepth limits how deeply includes may be nested; the default is 10.
+// Exceeding it returns an error wrapping ErrIncludeDepth.
+func WithMaxIncludeDepth(depth int) Option {
+	return func(l *Loader) {
+		l.maxIncludeDepth = depth
+	}
+}
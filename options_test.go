@@ -0,0 +1,173 @@
+package kdlconfig
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ykhdr/kdl-config/rules"
+)
+
+type optionsConfig struct {
+	Port int    `kdl:"port" default:"8080" check:"max=9000" validate:"min=1"`
+	Name string `kdl:"name" validate:"shout"`
+}
+
+// recordingLogger collects the messages logged at any level. It is safe for concurrent use.
+type recordingLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (r *recordingLogger) record(msg string, _ ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, msg)
+}
+
+func (r *recordingLogger) messages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.msgs...)
+}
+
+func (r *recordingLogger) Debug(msg string, args ...any) { r.record(msg, args...) }
+func (r *recordingLogger) Info(msg string, args ...any)  { r.record(msg, args...) }
+func (r *recordingLogger) Warn(msg string, args ...any)  { r.record(msg, args...) }
+func (r *recordingLogger) Error(msg string, args ...any) { r.record(msg, args...) }
+
+type shoutRule struct{}
+
+func (*shoutRule) Name() string { return "shout" }
+func (*shoutRule) Validate(fv reflect.Value, _ reflect.StructField) error {
+	if s := fv.String(); s != "" && s[len(s)-1] != '!' {
+		return fmt.Errorf("%q is not shouted", s)
+	}
+	return nil
+}
+
+func shoutFactory(string) (rules.Rule, error) { return &shoutRule{}, nil }
+
+func TestLoaderOptions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"valid.kdl":   {Data: []byte("name \"hi!\"\n")},
+		"quiet.kdl":   {Data: []byte("name \"hi\"\n")},
+		"unknown.kdl": {Data: []byte("name \"hi!\"\nprot 80\n")},
+		"high.kdl":    {Data: []byte("port 9500\nname \"hi!\"\n")},
+	}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		file    string
+		want    *optionsConfig
+		wantErr string
+	}{
+		{
+			name: "fs and per-loader rule",
+			opts: []Option{WithFS(fsys), WithRule("shout", shoutFactory)},
+			file: "valid.kdl",
+			want: &optionsConfig{Port: 8080, Name: "hi!"},
+		},
+		{
+			name:    "per-loader rule rejects",
+			opts:    []Option{WithFS(fsys), WithRule("shout", shoutFactory)},
+			file:    "quiet.kdl",
+			wantErr: "is not shouted",
+		},
+		{
+			name:    "rule unknown without option",
+			opts:    []Option{WithFS(fsys)},
+			file:    "valid.kdl",
+			wantErr: `unknown validation rule "shout"`,
+		},
+		{
+			name:    "strict by default",
+			opts:    []Option{WithFS(fsys), WithRule("shout", shoutFactory)},
+			file:    "unknown.kdl",
+			wantErr: `"prot"`,
+		},
+		{
+			name: "lenient ignores unknown nodes",
+			opts: []Option{WithFS(fsys), WithRule("shout", shoutFactory), WithStrict(false)},
+			file: "unknown.kdl",
+			want: &optionsConfig{Port: 8080, Name: "hi!"},
+		},
+		{
+			name:    "defaults disabled",
+			opts:    []Option{WithFS(fsys), WithRule("shout", shoutFactory), WithDefaults(false)},
+			file:    "valid.kdl",
+			wantErr: "value 0 < min 1",
+		},
+		{
+			name:    "custom tag name",
+			opts:    []Option{WithFS(fsys), WithTagName("check")},
+			file:    "high.kdl",
+			wantErr: "value 9500 > max 9000",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &optionsConfig{}
+			err := NewLoader(tt.opts...).Load(cfg, tt.file)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, cfg)
+		})
+	}
+}
+
+func TestLoaderOptions_Logger(t *testing.T) {
+	fsys := fstest.MapFS{"config.kdl": {Data: []byte("port 80\n")}}
+	logger := &recordingLogger{}
+
+	t.Setenv("APP_NAME", "env!")
+	cfg := &optionsConfig{}
+	err := NewLoader(WithFS(fsys), WithLogger(logger), WithEnvPrefix("APP"), WithRule("shout", shoutFactory)).
+		Load(cfg, "config.kdl")
+	require.NoError(t, err)
+	require.Equal(t, "env!", cfg.Name)
+	require.Equal(t, []string{"applied environment override", "config loaded"}, logger.messages())
+}
+
+func TestLoaderOptions_Independent(t *testing.T) {
+	fsys := fstest.MapFS{"config.kdl": {Data: []byte("name \"hi\"\n")}}
+
+	// a rule registered on one loader does not leak into another
+	withRule := NewLoader(WithFS(fsys), WithRule("shout", shoutFactory))
+	plain := NewLoader(WithFS(fsys), WithRule("shout", func(string) (rules.Rule, error) {
+		return &passRule{}, nil
+	}))
+
+	require.Error(t, withRule.Load(&optionsConfig{}, "config.kdl"))
+	require.NoError(t, plain.Load(&optionsConfig{}, "config.kdl"))
+}
+
+type passRule struct{}
+
+func (*passRule) Name() string                                      { return "pass" }
+func (*passRule) Validate(reflect.Value, reflect.StructField) error { return nil }
+
+func TestLoaderOptions_Registry(t *testing.T) {
+	fsys := fstest.MapFS{"config.kdl": {Data: []byte("name \"hi\"\n")}}
+
+	strict := rules.NewRegistry()
+	strict.Register("shout", shoutFactory)
+	relaxed := strict.Clone()
+	relaxed.Register("shout", func(string) (rules.Rule, error) { return &passRule{}, nil })
+
+	require.Error(t, NewLoader(WithFS(fsys), WithRegistry(strict)).Load(&optionsConfig{}, "config.kdl"))
+	require.NoError(t, NewLoader(WithFS(fsys), WithRegistry(relaxed)).Load(&optionsConfig{}, "config.kdl"))
+	require.False(t, rules.DefaultRegistry().Has("shout"), "loader registries must not leak into the default one")
+
+	// WithRule takes precedence over the registry regardless of option order
+	l := NewLoader(WithFS(fsys), WithRule("shout", shoutFactory), WithRegistry(relaxed))
+	require.Error(t, l.Load(&optionsConfig{}, "config.kdl"))
+}
@@ -0,0 +1,79 @@
+package kdlconfig
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// applyOverrides sets the fields of the struct cfg points to whose KDL path is a key of
+// overrides (see WithOverride). It fails if a path matches no field.
+func applyOverrides(cfg any, overrides map[string]string) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("applyOverrides: expected pointer to struct, got %T", cfg)
+	}
+	set := make(map[string]bool, len(overrides))
+	if err := applyStructOverrides(v.Elem(), fieldPath{}, overrides, set); err != nil {
+		return err
+	}
+	if len(set) == len(overrides) {
+		return nil
+	}
+	var unknown []string
+	for path := range overrides {
+		if !set[path] {
+			unknown = append(unknown, path)
+		}
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("override of unknown field %q", unknown[0])
+}
+
+// applyStructOverrides applies overrides to the fields of struct v, recording the
+// paths it sets in set.
+func applyStructOverrides(v reflect.Value, path fieldPath, overrides map[string]string, set map[string]bool) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		if !fv.CanSet() {
+			continue
+		}
+		fp := path.field(sf)
+
+		// fields without a node of their own cannot be addressed by path
+		if raw, ok := overrides[fp.kdlPath]; ok && fp.kdlPath != path.kdlPath {
+			if err := setValue(fv, raw); err != nil {
+				return fmt.Errorf("invalid override for %s (%s): %w", fp.kdlPath, fp.goPath, err)
+			}
+			set[fp.kdlPath] = true
+			continue
+		}
+		if !isStructLike(fv.Type()) {
+			continue
+		}
+
+		switch {
+		case fv.Kind() == reflect.Struct:
+			if err := applyStructOverrides(fv, fp, overrides, set); err != nil {
+				return err
+			}
+		case !fv.IsNil():
+			if err := applyStructOverrides(fv.Elem(), fp, overrides, set); err != nil {
+				return err
+			}
+		default:
+			// a nil pointer is only allocated if an override applies to the struct behind it
+			before := len(set)
+			elem := reflect.New(fv.Type().Elem())
+			if err := applyStructOverrides(elem.Elem(), fp, overrides, set); err != nil {
+				return err
+			}
+			if len(set) > before {
+				fv.Set(elem)
+			}
+		}
+	}
+	return nil
+}
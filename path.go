@@ -0,0 +1,97 @@
+package kdlconfig
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// fieldPath tracks where a value lives inside a config struct while it is being walked.
+// goPath is the Go selector of the value (e.g. "Database.Primary.Port"),
+// kdlPath is the matching chain of KDL node names (e.g. "database.primary.port").
+type fieldPath struct {
+	goPath  string
+	kdlPath string
+}
+
+// field returns the path of the struct field sf nested under p.
+// Fields that kdl-go does not map to a node of their own (embedded structs and
+// fields tagged `,arg`, `,args`, `,props` or `,children`) do not add a KDL segment.
+func (p fieldPath) field(sf reflect.StructField) fieldPath {
+	next := p
+	if !sf.Anonymous {
+		next.goPath = joinPath(p.goPath, sf.Name)
+	}
+	if name := kdlFieldName(sf); name != "" {
+		next.kdlPath = joinPath(p.kdlPath, name)
+	}
+	return next
+}
+
+// index returns the path of the i-th element of the slice or array at p.
+func (p fieldPath) index(i int) fieldPath {
+	suffix := "[" + strconv.Itoa(i) + "]"
+	return fieldPath{goPath: p.goPath + suffix, kdlPath: p.kdlPath + suffix}
+}
+
+// key returns the path of the map entry with key k of the map at p.
+// String keys are quoted (`upstreams["eu"]`), other keys are formatted with %v.
+func (p fieldPath) key(k reflect.Value) fieldPath {
+	var suffix string
+	if k.Kind() == reflect.String {
+		suffix = "[" + strconv.Quote(k.String()) + "]"
+	} else {
+		suffix = fmt.Sprintf("[%v]", k)
+	}
+	return fieldPath{goPath: p.goPath + suffix, kdlPath: p.kdlPath + suffix}
+}
+
+func joinPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// kdlFieldName returns the KDL node name kdl-go maps onto the struct field sf, or ""
+// if the field does not correspond to a node of its own.
+//
+// The rules mirror kdl-go: the name from the `kdl` tag wins, otherwise the field name
+// is lower-cased and stripped of everything except letters, digits and underscores.
+func kdlFieldName(sf reflect.StructField) string {
+	if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+		return ""
+	}
+	name, attrs := parseKDLTag(sf.Tag.Get("kdl"))
+	for _, attr := range attrs {
+		switch attr {
+		case "arg", "args", "props", "children":
+			return ""
+		}
+	}
+	if name != "" {
+		return name
+	}
+	return normalizeKDLName(sf.Name)
+}
+
+// parseKDLTag splits a `kdl` struct tag into the node name and its attributes.
+func parseKDLTag(tag string) (string, []string) {
+	if tag == "" {
+		return "", nil
+	}
+	parts := strings.Split(tag, ",")
+	return strings.ToLower(parts[0]), parts[1:]
+}
+
+// normalizeKDLName converts a Go field name to the node name kdl-go expects for it.
+func normalizeKDLName(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
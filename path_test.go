@@ -0,0 +1,81 @@
+package kdlconfig
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type kdlNameEmbedded struct {
+	Inner int
+}
+
+type kdlNameStruct struct {
+	kdlNameEmbedded
+	Plain    int
+	Tagged   int `kdl:"my-node"`
+	Upper    int `kdl:"UPPER,format:RFC3339"`
+	HTTPPort int
+	Arg      string            `kdl:",arg"`
+	Props    map[string]string `kdl:",props"`
+}
+
+func TestKDLFieldName(t *testing.T) {
+	typ := reflect.TypeOf(kdlNameStruct{})
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{field: "kdlNameEmbedded", want: ""},
+		{field: "Plain", want: "plain"},
+		{field: "Tagged", want: "my-node"},
+		{field: "Upper", want: "upper"},
+		{field: "HTTPPort", want: "httpport"},
+		{field: "Arg", want: ""},
+		{field: "Props", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			sf, ok := typ.FieldByName(tt.field)
+			require.True(t, ok)
+			require.Equal(t, tt.want, kdlFieldName(sf))
+		})
+	}
+}
+
+func TestFieldPath_Field(t *testing.T) {
+	typ := reflect.TypeOf(kdlNameStruct{})
+	embedded, _ := typ.FieldByName("kdlNameEmbedded")
+	tagged, _ := typ.FieldByName("Tagged")
+	arg, _ := typ.FieldByName("Arg")
+
+	root := fieldPath{goPath: "Server", kdlPath: "server"}
+
+	p := root.field(tagged)
+	require.Equal(t, "Server.Tagged", p.goPath)
+	require.Equal(t, "server.my-node", p.kdlPath)
+
+	p = root.field(embedded)
+	require.Equal(t, "Server", p.goPath)
+	require.Equal(t, "server", p.kdlPath)
+
+	p = root.field(arg)
+	require.Equal(t, "Server.Arg", p.goPath)
+	require.Equal(t, "server", p.kdlPath)
+}
+
+func TestFieldPath_IndexAndKey(t *testing.T) {
+	root := fieldPath{goPath: "Upstreams", kdlPath: "upstreams"}
+
+	p := root.key(reflect.ValueOf("eu")).field(reflect.StructField{Name: "Timeout"})
+	require.Equal(t, `Upstreams["eu"].Timeout`, p.goPath)
+	require.Equal(t, `upstreams["eu"].timeout`, p.kdlPath)
+
+	p = root.key(reflect.ValueOf(42))
+	require.Equal(t, "upstreams[42]", p.kdlPath)
+
+	p = fieldPath{goPath: "Listeners", kdlPath: "listeners"}.index(2)
+	require.Equal(t, "Listeners[2]", p.goPath)
+	require.Equal(t, "listeners[2]", p.kdlPath)
+}
@@ -0,0 +1,86 @@
+package kdlconfig
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultPollInterval is how often a Watcher polls when it falls back to polling
+// because fsnotify is not available, see WithPolling.
+const defaultPollInterval = time.Second
+
+// fileState is what polling remembers about a file to tell whether it changed.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	// hash is the SHA-256 of the contents; it is only computed for config files, as
+	// hashed tells, and catches changes a coarse modification time would miss.
+	hash   [sha256.Size]byte
+	hashed bool
+}
+
+// poll scans the watched directories and reports whether a config file was added,
+// changed or removed since the previous scan. A directory scanned for the first time
+// only records the state of its files. It is called from the loop goroutine only.
+func (w *Watcher) poll() bool {
+	changed := false
+	states := make(map[string]fileState, len(w.pollStates))
+	scanned := make(map[string]bool, len(w.dirs))
+	for dir := range w.dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		scanned[dir] = true
+		for _, e := range entries {
+			p := filepath.Join(dir, e.Name())
+			// follow symlinks, so that a swapped ConfigMap shows up as changed contents
+			info, err := os.Stat(p)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			st := fileState{modTime: info.ModTime(), size: info.Size()}
+			if w.isConfigFile(p) {
+				data, err := os.ReadFile(p)
+				if err != nil {
+					continue
+				}
+				st.hash, st.hashed = sha256.Sum256(data), true
+			}
+			states[p] = st
+
+			old, seen := w.pollStates[p]
+			switch {
+			case !st.hashed || !w.polled[dir]:
+			case !seen, !old.modTime.Equal(st.modTime), old.size != st.size:
+				changed = true
+			case old.hashed && old.hash != st.hash:
+				changed = true
+			}
+		}
+	}
+	for p := range w.pollStates {
+		if _, ok := states[p]; !ok && w.polled[filepath.Dir(p)] && w.isConfigFile(p) {
+			// removed, or its directory went away
+			changed = true
+		}
+	}
+	w.pollStates, w.polled = states, scanned
+	return changed
+}
+
+// isConfigFile reports whether p is one of the config files or matches one of the
+// patterns they were expanded from.
+func (w *Watcher) isConfigFile(p string) bool {
+	if w.names[p] {
+		return true
+	}
+	for _, pattern := range w.patterns {
+		if ok, _ := filepath.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package kdlconfig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sblinch/kdl-go/document"
+)
+
+// Position identifies a location in a KDL source.
+// Line and Column are 1-based; a zero Line means the location within the file is unknown.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position points at a line within the file.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String formats the position as "file:line:column", omitting the parts that are unknown.
+func (p Position) String() string {
+	if !p.IsValid() {
+		return p.File
+	}
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// nodePosition records where a node and each of its arguments and properties were read from.
+type nodePosition struct {
+	Position
+	args  []Position
+	props map[string]Position
+}
+
+// positions maps the nodes of a parsed document to their location in the source.
+type positions map[*document.Node]*nodePosition
+
+// pathIndex maps KDL paths (as produced by fieldPath) to source positions.
+type pathIndex map[string]Position
+
+// index builds a pathIndex for the nodes of a document.
+//
+// Every node is registered under its dotted path ("database.primary.port") when it is the
+// first node of that name among its siblings, and under an indexed path ("listener[2]")
+// for each occurrence; properties are registered like child nodes unless a child of the
+// same name exists. A node holding a single argument and nothing else is registered at
+// the position of that argument, so that errors about a scalar point at the value.
+func (p positions) index(nodes []*document.Node) pathIndex {
+	idx := make(pathIndex)
+	p.indexNodes(idx, nodes, []string{""})
+	return idx
+}
+
+func (p positions) indexNodes(idx pathIndex, nodes []*document.Node, parents []string) {
+	seen := make(map[string]int)
+	for _, n := range nodes {
+		name := n.Name.ValueString()
+		occurrence := seen[name]
+		seen[name]++
+
+		np, ok := p[n]
+		if !ok {
+			continue
+		}
+
+		var keys []string
+		for _, parent := range parents {
+			if occurrence == 0 {
+				keys = append(keys, joinPath(parent, name))
+			}
+			keys = append(keys, fmt.Sprintf("%s[%d]", joinPath(parent, name), occurrence))
+		}
+		pos := np.Position
+		if len(np.args) == 1 && len(np.props) == 0 && len(n.Children) == 0 {
+			// a scalar field such as `port 70000`: point at the value itself
+			pos = np.args[0]
+		}
+		for _, key := range keys {
+			idx[key] = pos
+			for prop, pos := range np.props {
+				propKey := joinPath(key, prop)
+				if _, exists := idx[propKey]; !exists {
+					idx[propKey] = pos
+				}
+			}
+		}
+		p.indexNodes(idx, n.Children, keys)
+	}
+}
+
+// lookup returns the position of the node at path. If there is no such node (typically
+// because the field was absent from the document), the position of the closest enclosing
+// node is returned instead; if there is none, only file is set.
+func (idx pathIndex) lookup(path, file string) Position {
+	key := normalizeIndexPath(path)
+	for key != "" {
+		if pos, ok := idx[key]; ok {
+			return pos
+		}
+		key = parentPath(key)
+	}
+	return Position{File: file}
+}
+
+// normalizeIndexPath rewrites map key segments (`upstreams["eu"]`) into the child node
+// form used by pathIndex (`upstreams.eu`).
+func normalizeIndexPath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '[' && i+1 < len(path) && path[i+1] == '"' {
+			quoted, err := strconv.QuotedPrefix(path[i+1:])
+			if err == nil {
+				key, _ := strconv.Unquote(quoted)
+				b.WriteByte('.')
+				b.WriteString(key)
+				i += len(quoted) + 1 // skip the quoted key and the closing bracket
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// parentPath strips the last segment from a normalized path.
+func parentPath(path string) string {
+	i := strings.LastIndexAny(path, ".[")
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
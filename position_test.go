@@ -0,0 +1,55 @@
+package kdlconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPosition_String(t *testing.T) {
+	require.Equal(t, "config.kdl:3:7", Position{File: "config.kdl", Line: 3, Column: 7}.String())
+	require.Equal(t, "3:7", Position{Line: 3, Column: 7}.String())
+	require.Equal(t, "config.kdl", Position{File: "config.kdl"}.String())
+	require.False(t, Position{File: "config.kdl"}.IsValid())
+}
+
+func TestPathIndex_Lookup(t *testing.T) {
+	src, err := parseSource("config.kdl", []byte(
+		"listener addr=\"a\"\n"+
+			"listener {\n"+
+			"    addr \"b\"\n"+
+			"}\n"+
+			"upstreams {\n"+
+			"    eu {\n"+
+			"        timeout 5\n"+
+			"    }\n"+
+			"}\n"))
+	require.NoError(t, err)
+	idx := src.pos.index(src.doc.Nodes)
+
+	tests := []struct {
+		path string
+		want Position
+	}{
+		{path: "listener", want: Position{File: "config.kdl", Line: 1, Column: 1}},
+		{path: "listener.addr", want: Position{File: "config.kdl", Line: 1, Column: 10}},
+		{path: "listener[0].addr", want: Position{File: "config.kdl", Line: 1, Column: 10}},
+		// scalar nodes resolve to their value
+		{path: "listener[1].addr", want: Position{File: "config.kdl", Line: 3, Column: 10}},
+		{path: `upstreams["eu"].timeout`, want: Position{File: "config.kdl", Line: 7, Column: 17}},
+		// absent nodes resolve to the closest enclosing node
+		{path: `upstreams["eu"].retries`, want: Position{File: "config.kdl", Line: 6, Column: 5}},
+		{path: "missing", want: Position{File: "config.kdl"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			require.Equal(t, tt.want, idx.lookup(tt.path, "config.kdl"))
+		})
+	}
+}
+
+func TestNormalizeIndexPath(t *testing.T) {
+	require.Equal(t, "upstreams.eu.timeout", normalizeIndexPath(`upstreams["eu"].timeout`))
+	require.Equal(t, "m.a.b[2]", normalizeIndexPath(`m["a.b"][2]`))
+	require.Equal(t, "listeners[2].addr", normalizeIndexPath("listeners[2].addr"))
+}
@@ -0,0 +1,204 @@
+package kdlconfig
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// OriginKind tells which stage of loading set the value of a config field.
+type OriginKind int
+
+const (
+	// OriginUnset means nothing set the field: it holds its zero value.
+	OriginUnset OriginKind = iota
+	// OriginFile means the value was read from a config file.
+	OriginFile
+	// OriginDefault means the value comes from the field's `default` tag.
+	OriginDefault
+	// OriginEnv means the value was taken from an environment variable (see WithEnvPrefix).
+	OriginEnv
+	// OriginOverride means the value was set with WithOverride.
+	OriginOverride
+)
+
+func (k OriginKind) String() string {
+	switch k {
+	case OriginUnset:
+		return "unset"
+	case OriginFile:
+		return "file"
+	case OriginDefault:
+		return "default"
+	case OriginEnv:
+		return "env"
+	case OriginOverride:
+		return "override"
+	}
+	return fmt.Sprintf("OriginKind(%d)", int(k))
+}
+
+// Origin records where the value of a config field came from.
+type Origin struct {
+	Kind OriginKind
+	// Field is the full Go path of the field, e.g. "Database.Primary.Port".
+	Field string
+	// Value is the value the field was loaded with.
+	Value any
+	// Pos is where the value was read from; it is only set for OriginFile.
+	Pos Position
+	// Source is the name of the environment variable for OriginEnv, and the raw text
+	// of the tag or override for OriginDefault and OriginOverride.
+	Source string
+}
+
+// String describes the origin, e.g. "config.kdl:4:5" or "environment variable APP_PORT".
+func (o Origin) String() string {
+	switch o.Kind {
+	case OriginFile:
+		return o.Pos.String()
+	case OriginDefault:
+		return fmt.Sprintf("default tag %q", o.Source)
+	case OriginEnv:
+		return "environment variable " + o.Source
+	case OriginOverride:
+		return fmt.Sprintf("override %q", o.Source)
+	}
+	return "not set"
+}
+
+// Provenance maps the KDL path of every loaded config field (e.g. "database.timeout",
+// `upstreams["eu"].port`, "listener[1].addr") to the Origin of its value.
+// Structs are descended into, so the entries are the leaves of the config.
+type Provenance map[string]Origin
+
+// Explain describes in one line the value at path and where it came from:
+//
+//	database.timeout = 30s (from environment variable APP_DATABASE_TIMEOUT)
+//
+// path is a KDL path as used for the keys of p; a Go path ("Database.Timeout") is
+// accepted as well.
+func (p Provenance) Explain(path string) string {
+	o, ok := p[path]
+	if !ok {
+		for key, origin := range p {
+			if origin.Field == path {
+				path, o, ok = key, origin, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return fmt.Sprintf("%s: no such field", path)
+	}
+
+	value := fmt.Sprintf("%v", o.Value)
+	if s, isString := o.Value.(string); isString {
+		value = fmt.Sprintf("%q", s)
+	}
+	if o.Kind == OriginUnset {
+		return fmt.Sprintf("%s = %s (not set)", path, value)
+	}
+	return fmt.Sprintf("%s = %s (from %s)", path, value, o)
+}
+
+// LoadProvenance loads the config files at paths into cfg like LoadLayered (or Load,
+// for a single path) and reports where the value of every field came from.
+func (l *Loader) LoadProvenance(cfg interface{}, paths ...string) (Provenance, error) {
+	src, err := l.loadLayered(cfg, paths)
+	if err != nil {
+		return nil, err
+	}
+	return src.provenance(cfg, l.overrides), nil
+}
+
+// provenance builds the Provenance of cfg, which was decoded from s with overrides applied.
+func (s *source) provenance(cfg any, overrides map[string]string) Provenance {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	b := &provenanceBuilder{
+		src:       s,
+		idx:       s.pos.index(s.doc.Nodes),
+		overrides: overrides,
+		out:       make(Provenance),
+	}
+	b.structFields(v.Elem(), fieldPath{})
+	return b.out
+}
+
+type provenanceBuilder struct {
+	src       *source
+	idx       pathIndex
+	overrides map[string]string
+	out       Provenance
+}
+
+// structFields records the origins of the fields of struct v.
+func (b *provenanceBuilder) structFields(v reflect.Value, path fieldPath) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		if !fv.CanSet() {
+			continue
+		}
+		b.value(fv, path.field(sf))
+	}
+}
+
+// value records the origin of v, descending into structs and collections of structs.
+func (b *provenanceBuilder) value(v reflect.Value, path fieldPath) {
+	switch {
+	case isStructLike(v.Type()):
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				b.record(v, path)
+				return
+			}
+			v = v.Elem()
+		}
+		b.structFields(v, path)
+		return
+	case (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && isStructLike(v.Type().Elem()):
+		for i := 0; i < v.Len(); i++ {
+			b.value(v.Index(i), path.index(i))
+		}
+		return
+	case v.Kind() == reflect.Map && isStructLike(v.Type().Elem()):
+		for _, k := range sortedMapKeys(v) {
+			b.value(v.MapIndex(k), path.key(k))
+		}
+		return
+	}
+	b.record(v, path)
+}
+
+// record stores the origin of the leaf value v. Fields that share a KDL path with
+// their parent (`,arg`, `,props`, ...) keep the first origin recorded.
+func (b *provenanceBuilder) record(v reflect.Value, path fieldPath) {
+	if _, exists := b.out[path.kdlPath]; exists {
+		return
+	}
+	o := Origin{Field: path.goPath, Value: v.Interface()}
+	if raw, ok := lookupPath(b.overrides, path.kdlPath); ok {
+		o.Kind, o.Source = OriginOverride, raw
+	} else if name, ok := b.src.env.lookup(path.kdlPath); ok {
+		o.Kind, o.Source = OriginEnv, name
+	} else if raw, ok := lookupPath(b.src.defaults, path.kdlPath); ok {
+		o.Kind, o.Source = OriginDefault, raw
+	} else if pos, ok := b.idx[normalizeIndexPath(path.kdlPath)]; ok {
+		o.Kind, o.Pos = OriginFile, pos
+	}
+	b.out[path.kdlPath] = o
+}
+
+// lookupPath returns the value m holds for path or the closest of its parents.
+func lookupPath(m map[string]string, path string) (string, bool) {
+	for p := path; p != ""; p = parentPath(p) {
+		if v, ok := m[p]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
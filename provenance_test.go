@@ -0,0 +1,77 @@
+package kdlconfig
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type provenanceConfig struct {
+	Name     string `kdl:"name"`
+	Database struct {
+		Host    string        `kdl:"host" default:"localhost"`
+		Port    int           `kdl:"port"`
+		Timeout time.Duration `kdl:"timeout" default:"10s"`
+		User    string        `kdl:"user"`
+	} `kdl:"database"`
+	Listeners []includeListener `kdl:"listener,multiple"`
+	Debug     bool              `kdl:"debug"`
+}
+
+func TestLoader_LoadProvenance(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base.kdl":  "name \"svc\"\ndatabase {\n    port 5432\n}\nlistener addr=\":80\"\n",
+		"local.kdl": "database {\n    user \"dev\"\n}\n",
+	})
+	base, local := filepath.Join(dir, "base.kdl"), filepath.Join(dir, "local.kdl")
+	t.Setenv("PROV_DATABASE_TIMEOUT", "30s")
+
+	cfg := &provenanceConfig{}
+	prov, err := NewLoader(WithEnvPrefix("PROV"), WithOverride("debug", "true")).LoadProvenance(cfg, base, local)
+	require.NoError(t, err)
+
+	require.Equal(t, Origin{Kind: OriginFile, Field: "Name", Value: "svc", Pos: Position{File: base, Line: 1, Column: 6}}, prov["name"])
+	require.Equal(t, Origin{Kind: OriginFile, Field: "Database.Port", Value: 5432, Pos: Position{File: base, Line: 3, Column: 10}}, prov["database.port"])
+	require.Equal(t, Origin{Kind: OriginFile, Field: "Database.User", Value: "dev", Pos: Position{File: local, Line: 2, Column: 10}}, prov["database.user"])
+	require.Equal(t, Origin{Kind: OriginDefault, Field: "Database.Host", Value: "localhost", Source: "localhost"}, prov["database.host"])
+	require.Equal(t, Origin{Kind: OriginEnv, Field: "Database.Timeout", Value: 30 * time.Second, Source: "PROV_DATABASE_TIMEOUT"}, prov["database.timeout"])
+	require.Equal(t, Origin{Kind: OriginOverride, Field: "Debug", Value: true, Source: "true"}, prov["debug"])
+	require.Equal(t, OriginFile, prov["listener[0].addr"].Kind)
+	require.Equal(t, OriginUnset, prov["listener[0].tls"].Kind)
+
+	require.Equal(t, "database.timeout = 30s (from environment variable PROV_DATABASE_TIMEOUT)", prov.Explain("database.timeout"))
+	require.Equal(t, "database.timeout = 30s (from environment variable PROV_DATABASE_TIMEOUT)", prov.Explain("Database.Timeout"))
+	require.Equal(t, `database.user = "dev" (from `+local+`:2:10)`, prov.Explain("database.user"))
+	require.Equal(t, `database.host = "localhost" (from default tag "localhost")`, prov.Explain("database.host"))
+	require.Equal(t, `debug = true (from override "true")`, prov.Explain("debug"))
+	require.Equal(t, "listener[0].tls = false (not set)", prov.Explain("listener[0].tls"))
+	require.Equal(t, "database.prot: no such field", prov.Explain("database.prot"))
+}
+
+func TestLoader_LoadProvenance_Error(t *testing.T) {
+	prov, err := NewLoader().LoadProvenance(&provenanceConfig{}, writeConfig(t, "database {\n    prot 1\n}\n"))
+	require.Error(t, err)
+	require.Nil(t, prov)
+}
+
+func TestWithOverride(t *testing.T) {
+	path := writeConfig(t, "name \"svc\"\ndatabase {\n    port 5432\n}\n")
+	t.Setenv("OVR_DATABASE_PORT", "6000")
+
+	cfg := &provenanceConfig{}
+	loader := NewLoader(WithEnvPrefix("OVR"), WithOverride("database.port", "7000"), WithOverride("name", "api"))
+	require.NoError(t, loader.Load(cfg, path))
+	require.Equal(t, "api", cfg.Name)
+	// overrides win over the environment
+	require.Equal(t, 7000, cfg.Database.Port)
+
+	err := NewLoader(WithOverride("database.prot", "1")).Load(&provenanceConfig{}, path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `override of unknown field "database.prot"`)
+
+	err = NewLoader(WithOverride("database.port", "many")).Load(&provenanceConfig{}, path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid override for database.port")
+}
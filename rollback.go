@@ -0,0 +1,56 @@
+package kdlconfig
+
+import "errors"
+
+// ErrNoHistory is returned by Rollback when there is no previous config to go back to.
+var ErrNoHistory = errors.New("no previous config to roll back to")
+
+// Rollback makes the config that was current before the latest reload current again,
+// and delivers it to onChange like a reload would. It can be repeated to go further
+// back, as far as the history kept with WithHistory reaches; ErrNoHistory is returned
+// once it is exhausted. The BeforeApply hook, if any, must approve the rollback too.
+//
+// The file on disk is left alone: the next change to it is loaded as usual.
+// Rollback must not be called from onChange when WithSyncDelivery is used.
+func (w *Watcher) Rollback() error {
+	for {
+		w.applyMu.Lock()
+		if len(w.history) == 0 {
+			w.applyMu.Unlock()
+			return ErrNoHistory
+		}
+		cur, prev := w.current.Load(), w.history[len(w.history)-1]
+		w.applyMu.Unlock()
+
+		// the hook runs unlocked, so that it may look at History
+		if err := w.approve(cur, prev.Config); err != nil {
+			return err
+		}
+		w.applyMu.Lock()
+		if w.current.Load() != cur || len(w.history) == 0 || w.history[len(w.history)-1] != prev {
+			// a reload or another Rollback got in first
+			w.applyMu.Unlock()
+			continue
+		}
+		w.history = w.history[:len(w.history)-1]
+		w.setCurrent(prev.Config)
+		version := w.current.Load().Version
+		w.applyMu.Unlock()
+		w.deliverCurrent()
+		w.log().Info("config rolled back", "path", w.path, "version", version)
+		return nil
+	}
+}
+
+// History returns the previous configs kept with WithHistory, most recent first.
+// The current config is not included. It may be called from anywhere, including
+// onChange and the BeforeApply hook.
+func (w *Watcher) History() []Snapshot {
+	w.applyMu.Lock()
+	defer w.applyMu.Unlock()
+	out := make([]Snapshot, len(w.history))
+	for i, s := range w.history {
+		out[len(w.history)-1-i] = *s
+	}
+	return out
+}
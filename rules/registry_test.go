@@ -0,0 +1,80 @@
+package rules
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRegistry_Builtins(t *testing.T) {
+	r := NewRegistry()
+	require.Equal(t, []string{"len", "max", "min", "oneof", "pattern", "required"}, r.Names())
+
+	rule, err := r.Get("min=5")
+	require.NoError(t, err)
+	require.Equal(t, &minRule{Min: 5}, rule)
+
+	_, err = r.Get("unknown")
+	require.Error(t, err)
+}
+
+func TestRegistry_RegisterOverrideUnregister(t *testing.T) {
+	r := NewRegistry()
+
+	r.Register("custom", func(string) (Rule, error) { return &customRule{}, nil })
+	require.True(t, r.Has("custom"))
+
+	// override a built-in
+	r.Register("min", func(string) (Rule, error) { return &customRule{}, nil })
+	rule, err := r.Get("min=1")
+	require.NoError(t, err)
+	require.Equal(t, &customRule{}, rule)
+
+	require.True(t, r.Unregister("custom"))
+	require.False(t, r.Unregister("custom"))
+	require.False(t, r.Has("custom"))
+	_, err = r.Get("custom")
+	require.Error(t, err)
+}
+
+func TestRegistry_CloneIsIndependent(t *testing.T) {
+	base := NewRegistry()
+	clone := base.Clone()
+
+	clone.Register("custom", func(string) (Rule, error) { return &customRule{}, nil })
+	clone.Unregister("len")
+
+	require.False(t, base.Has("custom"))
+	require.True(t, base.Has("len"))
+	require.True(t, clone.Has("custom"))
+	require.False(t, clone.Has("len"))
+}
+
+func TestRegistry_IsolatedFromDefault(t *testing.T) {
+	r := NewRegistry()
+	r.Register("isolated", func(string) (Rule, error) { return &customRule{}, nil })
+
+	require.False(t, DefaultRegistry().Has("isolated"))
+	_, err := GetRule("isolated")
+	require.Error(t, err)
+}
+
+func TestRegistry_ConcurrentUse(t *testing.T) {
+	r := NewRegistry()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			r.Register("custom", func(string) (Rule, error) { return &customRule{}, nil })
+			r.Unregister("custom")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		rule, err := r.Get("required")
+		require.NoError(t, err)
+		require.NoError(t, rule.Validate(reflect.ValueOf(1), reflect.StructField{}))
+		_ = r.Clone()
+	}
+	<-done
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,94 +24,193 @@ type Rule interface {
 type RuleFactory func(param string) (Rule, error)
 
 // ─────────────────────────────────────────────────────────────────────────────
-// Registry and registration
+// Registry
 // ─────────────────────────────────────────────────────────────────────────────
 
-var (
-	regMu              sync.RWMutex
-	registry           = make(map[string]RuleFactory)
-	defaultRulesLoaded bool
-)
+// Registry maps rule names to their factories. It is safe for concurrent use.
+//
+// Registries are independent of each other: rules registered in one are not visible
+// in another, which lets libraries and tests keep their rules to themselves.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]RuleFactory
+}
 
-// RegisterRule thread-safely registers a new rule factory.
-func RegisterRule(name string, factory RuleFactory) {
-	regMu.Lock()
-	defer regMu.Unlock()
-	registry[name] = factory
+// NewRegistry creates a Registry with the built-in rules already registered.
+func NewRegistry() *Registry {
+	r := &Registry{factories: make(map[string]RuleFactory, len(builtinRules))}
+	for name, factory := range builtinRules {
+		r.factories[name] = factory
+	}
+	return r
 }
 
-// GetRule returns a Rule instance from a "raw" string, for example "min=5".
-func GetRule(raw string) (Rule, error) {
-	parts := strings.SplitN(raw, "=", 2)
-	name := parts[0]
+// Register registers factory under name, overriding any rule of the same name.
+func (r *Registry) Register(name string, factory RuleFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = factory
+}
 
-	regMu.RLock()
-	factory, ok := registry[name]
-	regMu.RUnlock()
-	if !ok {
-		return nil, fmt.Errorf("unknown validation rule %q", name)
+// Unregister removes the rule called name and reports whether it was registered.
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.factories[name]
+	delete(r.factories, name)
+	return ok
+}
+
+// Has reports whether a rule called name is registered.
+func (r *Registry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.factories[name]
+	return ok
+}
+
+// Names returns the names of all registered rules in sorted order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
+
+// Clone returns an independent copy of the registry.
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := &Registry{factories: make(map[string]RuleFactory, len(r.factories))}
+	for name, factory := range r.factories {
+		c.factories[name] = factory
+	}
+	return c
+}
 
-	param := ""
-	if len(parts) == 2 {
-		param = parts[1]
+// Get returns a Rule instance from a "raw" string, for example "min=5".
+func (r *Registry) Get(raw string) (Rule, error) {
+	name, param, _ := strings.Cut(raw, "=")
+	if isScopeMarker(name) {
+		return nil, fmt.Errorf("%q scopes the rules of a tag and is not a rule itself; use ParseTag", name)
+	}
+
+	r.mu.RLock()
+	factory, ok := r.factories[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown validation rule %q", name)
 	}
 	return factory(param)
 }
 
+// ─────────────────────────────────────────────────────────────────────────────
+// Default registry
+// ─────────────────────────────────────────────────────────────────────────────
+
+var (
+	regMu              sync.Mutex
+	defaultRegistry    = NewRegistry()
+	defaultRulesLoaded = true
+)
+
+// DefaultRegistry returns the process-wide registry used by RegisterRule and GetRule,
+// and by every Loader that is not given a registry of its own.
+func DefaultRegistry() *Registry {
+	regMu.Lock()
+	defer regMu.Unlock()
+	return defaultRegistry
+}
+
+// RegisterRule thread-safely registers a new rule factory in the default registry.
+func RegisterRule(name string, factory RuleFactory) {
+	DefaultRegistry().Register(name, factory)
+}
+
+// GetRule returns a Rule instance from a "raw" string, for example "min=5",
+// using the default registry.
+func GetRule(raw string) (Rule, error) {
+	return DefaultRegistry().Get(raw)
+}
+
 // RegisterDefaultRules registers built-in rules with **one** call.
 // Can be called multiple times — actual registration will happen only once.
+//
+// The default registry already contains the built-in rules, so this is only kept
+// for compatibility.
 func RegisterDefaultRules() {
 	regMu.Lock()
 	defer regMu.Unlock()
-
 	if defaultRulesLoaded {
 		return
 	}
 	defaultRulesLoaded = true
 
+	defaultRegistry.mu.Lock()
+	defer defaultRegistry.mu.Unlock()
+	for name, factory := range builtinRules {
+		if _, ok := defaultRegistry.factories[name]; !ok {
+			defaultRegistry.factories[name] = factory
+		}
+	}
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Built-in rules
+// ─────────────────────────────────────────────────────────────────────────────
+
+var builtinRules = map[string]RuleFactory{
 	// required
-	registry["required"] = func(_ string) (Rule, error) {
+	"required": func(_ string) (Rule, error) {
 		return &requiredRule{}, nil
-	}
+	},
+
 	// min
-	registry["min"] = func(param string) (Rule, error) {
+	"min": func(param string) (Rule, error) {
 		f, err := strconv.ParseFloat(param, 64)
 		if err != nil {
 			return nil, fmt.Errorf("invalid min value %q: %w", param, err)
 		}
 		return &minRule{Min: f}, nil
-	}
+	},
+
 	// max
-	registry["max"] = func(param string) (Rule, error) {
+	"max": func(param string) (Rule, error) {
 		f, err := strconv.ParseFloat(param, 64)
 		if err != nil {
 			return nil, fmt.Errorf("invalid max value %q: %w", param, err)
 		}
 		return &maxRule{Max: f}, nil
-	}
+	},
+
 	// len
-	registry["len"] = func(param string) (Rule, error) {
+	"len": func(param string) (Rule, error) {
 		n, err := strconv.Atoi(param)
 		if err != nil {
 			return nil, fmt.Errorf("invalid len value %q: %w", param, err)
 		}
 		return &lenRule{Length: n}, nil
-	}
+	},
+
 	// oneof
-	registry["oneof"] = func(param string) (Rule, error) {
+	"oneof": func(param string) (Rule, error) {
 		opts := strings.Split(param, "|")
 		if len(opts) == 0 {
 			return nil, fmt.Errorf("oneof: at least one option must be specified")
 		}
 		return &oneOfRule{Options: opts}, nil
-	}
+	},
+
 	// pattern (regex)
-	registry["pattern"] = func(param string) (Rule, error) {
+	"pattern": func(param string) (Rule, error) {
 		re, err := regexp.Compile(param)
 		if err != nil {
 			return nil, fmt.Errorf("invalid pattern %q: %w", param, err)
 		}
 		return &patternRule{Re: re}, nil
-	}
+	},
 }
@@ -64,7 +64,7 @@ func TestRegisterDefaultRules(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Clear the registry before each test
 			regMu.Lock()
-			registry = make(map[string]RuleFactory)
+			defaultRegistry = &Registry{factories: make(map[string]RuleFactory)}
 			defaultRulesLoaded = false
 			regMu.Unlock()
 
@@ -75,9 +75,7 @@ func TestRegisterDefaultRules(t *testing.T) {
 
 			// Check if each expected rule is registered
 			for _, rule := range expectedRules {
-				regMu.RLock()
-				_, exists := registry[rule]
-				regMu.RUnlock()
+				exists := DefaultRegistry().Has(rule)
 				require.True(t, exists, fmt.Sprintf("expected rule %q to be registered", rule))
 			}
 		})
@@ -0,0 +1,100 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Markers that scope the rules of a validation tag to the elements or keys of a collection
+// instead of the collection itself.
+const (
+	// DiveTag applies the rules that follow it to every element of a slice, array or map.
+	DiveTag = "dive"
+	// KeysTag starts a group of rules applied to every key of a map; the group ends at EndKeysTag.
+	KeysTag = "keys"
+	// EndKeysTag ends a group started with KeysTag.
+	EndKeysTag = "endkeys"
+)
+
+// Tag is a parsed validation tag such as "required,dive,pattern=^[a-z]+$".
+type Tag struct {
+	// Rules are the raw rules (e.g. "min=1") applied to the value itself.
+	Rules []string
+	// Keys holds the rules applied to each key of a map, or nil.
+	Keys *Tag
+	// Elem holds the rules applied to each element of a slice, array or map, or nil.
+	Elem *Tag
+}
+
+// ParseTag splits a validation tag into rules scoped to the value, its map keys and its elements.
+//
+// A keys...endkeys group applies to the keys of the map at the level it appears in, and
+// everything after dive applies one level down, where dive, keys and endkeys may be used again:
+//
+//	"required,dive,pattern=^[a-z]+$"    // []string: at least one element, each matching the pattern
+//	"keys,oneof=a|b,endkeys,dive,min=0" // map[string]int: keys a or b, values >= 0
+func ParseTag(raw string) (*Tag, error) {
+	var tokens []string
+	for _, tok := range strings.Split(raw, ",") {
+		tokens = append(tokens, strings.TrimSpace(tok))
+	}
+	tag, _, err := parseTag(tokens, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid validation tag %q: %w", raw, err)
+	}
+	return tag, nil
+}
+
+// parseTag parses tokens up to the end of the current scope and returns the tokens left over.
+// Inside a keys group the scope ends at endkeys, which is consumed.
+func parseTag(tokens []string, inKeys bool) (*Tag, []string, error) {
+	tag := &Tag{}
+	for len(tokens) > 0 {
+		tok := tokens[0]
+		tokens = tokens[1:]
+
+		switch tok {
+		case KeysTag:
+			if inKeys {
+				return nil, nil, fmt.Errorf("%s cannot be nested", KeysTag)
+			}
+			if tag.Keys != nil {
+				return nil, nil, fmt.Errorf("%s may appear only once per level", KeysTag)
+			}
+			keys, rest, err := parseTag(tokens, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			tag.Keys = keys
+			tokens = rest
+		case EndKeysTag:
+			if !inKeys {
+				return nil, nil, fmt.Errorf("%s without %s", EndKeysTag, KeysTag)
+			}
+			return tag, tokens, nil
+		case DiveTag:
+			// everything up to the end of the scope belongs to the elements
+			elem, rest, err := parseTag(tokens, inKeys)
+			if err != nil {
+				return nil, nil, err
+			}
+			tag.Elem = elem
+			return tag, rest, nil
+		default:
+			tag.Rules = append(tag.Rules, tok)
+		}
+	}
+	if inKeys {
+		return nil, nil, fmt.Errorf("%s without %s", KeysTag, EndKeysTag)
+	}
+	return tag, nil, nil
+}
+
+// isScopeMarker reports whether name is one of the tag markers rather than a rule name.
+func isScopeMarker(name string) bool {
+	switch name {
+	case DiveTag, KeysTag, EndKeysTag:
+		return true
+	}
+	return false
+}
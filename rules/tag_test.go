@@ -0,0 +1,83 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    *Tag
+		wantErr bool
+	}{
+		{
+			name: "plain rules",
+			raw:  "required, min=1",
+			want: &Tag{Rules: []string{"required", "min=1"}},
+		},
+		{
+			name: "dive",
+			raw:  "min=1,dive,pattern=^[a-z]+$",
+			want: &Tag{
+				Rules: []string{"min=1"},
+				Elem:  &Tag{Rules: []string{"pattern=^[a-z]+$"}},
+			},
+		},
+		{
+			name: "keys and dive",
+			raw:  "keys,oneof=a|b,endkeys,dive,min=0",
+			want: &Tag{
+				Keys: &Tag{Rules: []string{"oneof=a|b"}},
+				Elem: &Tag{Rules: []string{"min=0"}},
+			},
+		},
+		{
+			name: "nested dive",
+			raw:  "len=2,dive,required,dive,max=9",
+			want: &Tag{
+				Rules: []string{"len=2"},
+				Elem: &Tag{
+					Rules: []string{"required"},
+					Elem:  &Tag{Rules: []string{"max=9"}},
+				},
+			},
+		},
+		{
+			name: "dive inside keys",
+			raw:  "keys,len=2,dive,min=1,endkeys,required",
+			want: &Tag{
+				Rules: []string{"required"},
+				Keys: &Tag{
+					Rules: []string{"len=2"},
+					Elem:  &Tag{Rules: []string{"min=1"}},
+				},
+			},
+		},
+		{name: "keys without endkeys", raw: "keys,min=1", wantErr: true},
+		{name: "endkeys without keys", raw: "min=1,endkeys", wantErr: true},
+		{name: "nested keys", raw: "keys,keys,endkeys,endkeys", wantErr: true},
+		{name: "duplicate keys", raw: "keys,endkeys,keys,endkeys", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTag(tt.raw)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetRule_ScopeMarker(t *testing.T) {
+	RegisterDefaultRules()
+	for _, name := range []string{DiveTag, KeysTag, EndKeysTag} {
+		_, err := GetRule(name)
+		require.Error(t, err, name)
+	}
+}
@@ -0,0 +1,172 @@
+package kdlconfig
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/sblinch/kdl-go"
+	"github.com/sblinch/kdl-go/document"
+
+	"github.com/ykhdr/kdl-config/internal/kdlpos"
+)
+
+// UnmarshalError is returned when a KDL document cannot be parsed or mapped onto the target struct.
+type UnmarshalError struct {
+	// Pos is the best-effort location of the problem; it may carry only the file name.
+	Pos Position
+	Err error
+}
+
+func (e *UnmarshalError) Error() string {
+	if e.Pos == (Position{}) {
+		return fmt.Sprintf("failed to unmarshal KDL: %v", e.Err)
+	}
+	return fmt.Sprintf("%s: failed to unmarshal KDL: %v", e.Pos, e.Err)
+}
+
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+// source is a parsed KDL document together with the positions of its nodes.
+type source struct {
+	name string
+	doc  *document.Document
+	pos  positions
+	// data is the text doc was parsed from; it is nil once doc has been modified.
+	data []byte
+	// includes lists the files spliced into doc by include directives, in the order read.
+	includes []string
+	// layers lists the files merged into doc by LoadLayered, in order; it is empty for a
+	// single document.
+	layers []string
+	// defaults and env record the fields set from `default` tags and environment
+	// variables when doc was decoded.
+	defaults appliedDefaults
+	env      envOverrides
+}
+
+// parseSource parses data and records where each node was read from.
+// name is used as the file name in positions and error messages.
+func parseSource(name string, data []byte) (*source, error) {
+	doc, err := kdl.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, &UnmarshalError{Pos: parseErrorPosition(name, err), Err: err}
+	}
+
+	src := &source{name: name, doc: doc, pos: make(positions), data: data}
+	// Positions are best-effort: if the scanner disagrees with the parser we simply go without.
+	if scanned, err := kdlpos.Scan(data); err == nil {
+		src.pos.add(name, doc.Nodes, scanned)
+	}
+	return src, nil
+}
+
+// encode returns the document in KDL form, ready to be unmarshaled. kdl-go only
+// unmarshals text, so a document changed by includes or merging is generated anew;
+// TestLoader_IncludeValueFormats checks that values keep their meaning on the way.
+func (s *source) encode() ([]byte, error) {
+	if s.data != nil {
+		return s.data, nil
+	}
+	var buf bytes.Buffer
+	if err := kdl.Generate(s.doc, &buf); err != nil {
+		return nil, fmt.Errorf("failed to encode merged KDL document: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// add records the positions of nodes, which must be the parsed counterpart of scanned.
+func (p positions) add(file string, nodes []*document.Node, scanned []*kdlpos.Node) {
+	if len(nodes) != len(scanned) {
+		return
+	}
+	for i, n := range nodes {
+		sn := scanned[i]
+		np := &nodePosition{Position: Position{File: file, Line: sn.Pos.Line, Column: sn.Pos.Column}}
+		for _, pos := range sn.Args {
+			np.args = append(np.args, Position{File: file, Line: pos.Line, Column: pos.Column})
+		}
+		if len(sn.Props) > 0 {
+			np.props = make(map[string]Position, len(sn.Props))
+			for name, pos := range sn.Props {
+				np.props[name] = Position{File: file, Line: pos.Line, Column: pos.Column}
+			}
+		}
+		p[n] = np
+		p.add(file, n.Children, sn.Children)
+	}
+}
+
+// annotate attaches source positions to the ValidationErrors in err.
+// Other errors are returned unchanged.
+func (s *source) annotate(err error) error {
+	verrs, ok := err.(ValidationErrors)
+	if !ok {
+		return err
+	}
+	idx := s.pos.index(s.doc.Nodes)
+	out := make(ValidationErrors, len(verrs))
+	for i, e := range verrs {
+		e.Pos = idx.lookup(e.Path, s.name)
+		out[i] = e
+	}
+	return out
+}
+
+// Positions of parse and unmarshal errors are recovered from the wording of kdl-go's
+// messages, which TestKDLGoErrorWording pins. Should a kdl-go upgrade change it, the
+// errors still carry the file name, but no line and column.
+var (
+	// kdl-go reports 0-based positions as "at line N, column M".
+	parseErrorRe = regexp.MustCompile(`at line (\d+), column (\d+)`)
+	// kdl-go's unmarshal errors name the offending node either quoted or as the first word.
+	quotedNodeRe  = regexp.MustCompile(`node "([^"]+)"`)
+	leadingNodeRe = regexp.MustCompile(`^(\S+) (?:expects|has unexpected)`)
+)
+
+func parseErrorPosition(name string, err error) Position {
+	pos := Position{File: name}
+	m := parseErrorRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return pos
+	}
+	line, _ := strconv.Atoi(m[1])
+	col, _ := strconv.Atoi(m[2])
+	pos.Line, pos.Column = line+1, col+1
+	return pos
+}
+
+// unmarshalError wraps an error returned by kdl.Unmarshal, locating the node it refers to.
+func (s *source) unmarshalError(err error) error {
+	pos := Position{File: s.name}
+	var name string
+	if m := quotedNodeRe.FindStringSubmatch(err.Error()); m != nil {
+		name = m[1]
+	} else if m := leadingNodeRe.FindStringSubmatch(err.Error()); m != nil {
+		name = m[1]
+	}
+	if name != "" {
+		if np := s.pos.find(s.doc.Nodes, name); np != nil {
+			pos = np.Position
+		}
+	}
+	return &UnmarshalError{Pos: pos, Err: err}
+}
+
+// find returns the position of the first node named name, searching depth-first.
+func (p positions) find(nodes []*document.Node, name string) *nodePosition {
+	for _, n := range nodes {
+		if n.Name.ValueString() == name {
+			if np, ok := p[n]; ok {
+				return np
+			}
+		}
+		if np := p.find(n.Children, name); np != nil {
+			return np
+		}
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package kdlconfig
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/sblinch/kdl-go"
+	"github.com/sblinch/kdl-go/document"
+)
+
+var (
+	kdlUnmarshalerType      = reflect.TypeOf((*kdl.Unmarshaler)(nil)).Elem()
+	kdlValueUnmarshalerType = reflect.TypeOf((*kdl.ValueUnmarshaler)(nil)).Elem()
+)
+
+// strictChecker walks a parsed document against the type it is about to be unmarshaled
+// into and collects every node, argument and property that has no field to go to.
+//
+// The walk mirrors how kdl-go maps nodes onto values, but instead of stopping at the
+// first surprise it reports all of them, each with its position and, where a field with
+// a similar name exists, a suggestion.
+type strictChecker struct {
+	src  *source
+	errs ValidationErrors
+}
+
+// checkStrict reports the parts of the document that cfg has no place for.
+func (s *source) checkStrict(cfg any) ValidationErrors {
+	t := reflect.TypeOf(cfg)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	c := &strictChecker{src: s}
+	c.structChildren(t, s.doc.Nodes, "")
+	return c.errs
+}
+
+// strictField is a struct field as kdl-go sees it, with embedded structs flattened.
+type strictField struct {
+	reflect.StructField
+	attrs []string
+}
+
+// strictFields indexes the fields of struct type t by the node and property name they accept.
+// names lists the names worth suggesting, in field order.
+func strictFields(t reflect.Type) (fields map[string]strictField, names []string) {
+	fields = make(map[string]strictField)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				walk(sf.Type)
+				continue
+			}
+			name, attrs := parseKDLTag(sf.Tag.Get("kdl"))
+			if !sf.IsExported() || name == "-" {
+				// kdl-go never fills these, so nodes named after them are unknown
+				continue
+			}
+			if name == "" {
+				name = normalizeKDLName(sf.Name)
+			}
+			fields[name] = strictField{StructField: sf, attrs: attrs}
+			if kdlFieldName(sf) != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	walk(t)
+	return fields, names
+}
+
+// withAttr returns the first field carrying attr.
+func withAttr(fields map[string]strictField, attr string) (strictField, bool) {
+	for _, f := range fields {
+		if hasAttr(f.attrs, attr) {
+			return f, true
+		}
+	}
+	return strictField{}, false
+}
+
+// structChildren checks nodes, the children of a node unmarshaled into struct type t.
+func (c *strictChecker) structChildren(t reflect.Type, nodes []*document.Node, path string) {
+	fields, names := strictFields(t)
+	for _, n := range nodes {
+		name := n.Name.ValueString()
+		f, ok := fields[name]
+		if !ok {
+			c.report(joinPath(path, name), c.nodePos(n), "unknown node %q%s", name, suggest(name, names))
+			continue
+		}
+		if hasAttr(f.attrs, "multiple") {
+			ft := indirectType(f.Type)
+			// maps consume leading arguments as keys, so only slices can be followed further
+			if ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array {
+				c.node(ft.Elem(), n, joinPath(path, name))
+			}
+			continue
+		}
+		c.node(f.Type, n, joinPath(path, name))
+	}
+}
+
+// node checks node n, which is unmarshaled into a value of type t.
+func (c *strictChecker) node(t reflect.Type, n *document.Node, path string) {
+	t = indirectType(t)
+	pt := reflect.PtrTo(t)
+	if pt.Implements(kdlUnmarshalerType) {
+		return
+	}
+	if len(n.Arguments) == 1 && (pt.Implements(textUnmarshalerType) || pt.Implements(kdlValueUnmarshalerType)) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return
+	case reflect.Struct:
+		c.structNode(t, n, path)
+	case reflect.Map:
+		for _, child := range n.Children {
+			c.node(t.Elem(), child, joinPath(path, child.Name.ValueString()))
+		}
+	case reflect.Slice, reflect.Array:
+		c.unexpectedChildren(n, path)
+	default:
+		// scalars take exactly one argument and nothing else
+		c.unexpectedArgs(n, 1, path)
+		c.unexpectedProps(n, nil, path)
+		c.unexpectedChildren(n, path)
+	}
+}
+
+// structNode checks the arguments, properties and children of n against struct type t.
+func (c *strictChecker) structNode(t reflect.Type, n *document.Node, path string) {
+	fields, names := strictFields(t)
+
+	if _, ok := withAttr(fields, "args"); !ok {
+		args := 0
+		for _, f := range fields {
+			if hasAttr(f.attrs, "arg") {
+				args++
+			}
+		}
+		c.unexpectedArgs(n, args, path)
+	}
+
+	if _, ok := withAttr(fields, "props"); !ok {
+		var known []string
+		for name := range fields {
+			known = append(known, name)
+		}
+		c.unexpectedProps(n, known, path, names...)
+	}
+
+	if f, ok := withAttr(fields, "children"); ok {
+		switch ft := indirectType(f.Type); ft.Kind() {
+		case reflect.Struct:
+			c.structChildren(ft, n.Children, path)
+		case reflect.Map:
+			for _, child := range n.Children {
+				c.node(ft.Elem(), child, joinPath(path, child.Name.ValueString()))
+			}
+		}
+		return
+	}
+	c.structChildren(t, n.Children, path)
+}
+
+// unexpectedArgs reports the arguments of n beyond the first want.
+func (c *strictChecker) unexpectedArgs(n *document.Node, want int, path string) {
+	for i := want; i < len(n.Arguments); i++ {
+		pos := c.nodePos(n)
+		if np, ok := c.src.pos[n]; ok && i < len(np.args) {
+			pos = np.args[i]
+		}
+		c.report(path, pos, "unexpected argument %s (%s accepts %d)", n.Arguments[i].ValueString(), n.Name.ValueString(), want)
+	}
+}
+
+// unexpectedProps reports the properties of n that are not in known, suggesting one of candidates.
+func (c *strictChecker) unexpectedProps(n *document.Node, known []string, path string, candidates ...string) {
+	for _, name := range sortedProps(n) {
+		if containsString(known, name) {
+			continue
+		}
+		pos := c.nodePos(n)
+		if np, ok := c.src.pos[n]; ok {
+			if p, ok := np.props[name]; ok {
+				pos = p
+			}
+		}
+		c.report(joinPath(path, name), pos, "unknown property %q%s", name, suggest(name, candidates))
+	}
+}
+
+// unexpectedChildren reports the children of n, which is unmarshaled into a value that has none.
+func (c *strictChecker) unexpectedChildren(n *document.Node, path string) {
+	for _, child := range n.Children {
+		name := child.Name.ValueString()
+		c.report(joinPath(path, name), c.nodePos(child), "unknown node %q: %s does not take children", name, n.Name.ValueString())
+	}
+}
+
+func (c *strictChecker) nodePos(n *document.Node) Position {
+	if np, ok := c.src.pos[n]; ok {
+		return np.Position
+	}
+	return Position{File: c.src.name}
+}
+
+func (c *strictChecker) report(path string, pos Position, format string, args ...any) {
+	c.errs = append(c.errs, ValidationError{Path: path, Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// sortedProps returns the property names of n in sorted order.
+func sortedProps(n *document.Node) []string {
+	names := make([]string, 0, n.Properties.Len())
+	for name := range n.Properties.Unordered() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// suggest returns `, did you mean "x"?` for the candidate closest to name, or "" if
+// none is close enough to be a plausible typo.
+func suggest(name string, candidates []string) string {
+	best, bestDist := "", 0
+	for _, cand := range candidates {
+		d := editDistance(name, cand)
+		if best == "" || d < bestDist {
+			best, bestDist = cand, d
+		}
+	}
+	if best == "" || bestDist > (utf8.RuneCountInString(name)+2)/3 {
+		return ""
+	}
+	return ", did you mean " + strconv.Quote(best) + "?"
+}
+
+// editDistance returns the optimal string alignment distance between a and b: the number
+// of single-rune insertions, deletions, substitutions and adjacent transpositions needed
+// to turn one into the other. Transpositions count once, so "prot" is 1 away from "port".
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(first int, rest ...int) int {
+	m := first
+	for _, v := range rest {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
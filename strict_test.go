@@ -0,0 +1,158 @@
+package kdlconfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type strictListener struct {
+	Addr string `kdl:"addr"`
+	TLS  bool   `kdl:"tls"`
+}
+
+type strictConfig struct {
+	Name     string `kdl:"name"`
+	Timeout  time.Duration
+	Started  time.Time         `kdl:"started"`
+	Database strictDatabase    `kdl:"database"`
+	Listen   []strictListener  `kdl:"listen,multiple"`
+	Labels   map[string]string `kdl:"labels"`
+	Extra    any               `kdl:"extra"`
+	Ignored  string            `kdl:"-"`
+	internal string
+}
+
+type strictDatabase struct {
+	Driver string `kdl:"driver,arg"`
+	Host   string `kdl:"host"`
+	Port   int    `kdl:"port"`
+}
+
+func TestCheckStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "valid",
+			content: "name \"svc\"\ntimeout 5\nstarted \"2024-01-02T03:04:05Z\"\n" +
+				"database \"pg\" host=\"db\" {\n    port 5432\n}\n" +
+				"listen addr=\":80\"\nlisten addr=\":443\" tls=true\n" +
+				"labels {\n    team \"core\"\n}\nextra 1 2 a=3 {\n    anything\n}\n",
+		},
+		{
+			name:    "unknown top-level node",
+			content: "name \"svc\"\nnmae \"x\"\n",
+			want:    []string{`2:1: nmae: unknown node "nmae", did you mean "name"?`},
+		},
+		{
+			name:    "unknown nested node",
+			content: "database {\n    host \"db\"\n    prot 5432\n}\n",
+			want:    []string{`3:5: database.prot: unknown node "prot", did you mean "port"?`},
+		},
+		{
+			name:    "no suggestion for unrelated name",
+			content: "database {\n    flavour \"pg\"\n}\n",
+			want:    []string{`2:5: database.flavour: unknown node "flavour"`},
+		},
+		{
+			name:    "unknown property",
+			content: "database hots=\"db\"\n",
+			want:    []string{`1:10: database.hots: unknown property "hots", did you mean "host"?`},
+		},
+		{
+			name:    "extra argument",
+			content: "database \"pg\" \"mysql\"\nname \"a\" \"b\"\n",
+			want: []string{
+				`1:15: database: unexpected argument mysql (database accepts 1)`,
+				`2:10: name: unexpected argument b (name accepts 1)`,
+			},
+		},
+		{
+			name:    "scalar with property and children",
+			content: "name \"svc\" lang=\"en\" {\n    first \"a\"\n}\n",
+			want: []string{
+				`1:12: name.lang: unknown property "lang"`,
+				`2:5: name.first: unknown node "first": name does not take children`,
+			},
+		},
+		{
+			name:    "inside multiple",
+			content: "listen addr=\":80\"\nlisten adr=\":443\" {\n    tsl true\n}\n",
+			want: []string{
+				`2:8: listen.adr: unknown property "adr", did you mean "addr"?`,
+				`3:5: listen.tsl: unknown node "tsl", did you mean "tls"?`,
+			},
+		},
+		{
+			name:    "fields the decoder does not fill",
+			content: "internal \"x\"\n- \"y\"\n",
+			want: []string{
+				`1:1: internal: unknown node "internal"`,
+				`2:1: -: unknown node "-"`,
+			},
+		},
+		{
+			name:    "every problem is reported",
+			content: "nmae \"svc\"\ndatabase {\n    prot 1\n    hots \"db\"\n}\ntimeuot 5\n",
+			want: []string{
+				`1:1: nmae: unknown node "nmae", did you mean "name"?`,
+				`3:5: database.prot: unknown node "prot", did you mean "port"?`,
+				`4:5: database.hots: unknown node "hots", did you mean "host"?`,
+				`6:1: timeuot: unknown node "timeuot", did you mean "timeout"?`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := parseSource("", []byte(tt.content))
+			require.NoError(t, err)
+
+			var got []string
+			for _, e := range src.checkStrict(&strictConfig{}) {
+				got = append(got, e.Error())
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"port", "host", "database", "listener"}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"prot", ", did you mean \"port\"?"},
+		{"hsot", ", did you mean \"host\"?"},
+		{"databse", ", did you mean \"database\"?"},
+		{"listenr", ", did you mean \"listener\"?"},
+		{"zzzz", ""},
+		{"x", ""},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, suggest(tt.name, candidates), tt.name)
+	}
+	require.Equal(t, "", suggest("port", nil))
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"port", "port", 0},
+		{"prot", "port", 1},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"héllo", "hello", 1},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, editDistance(tt.a, tt.b), "%s -> %s", tt.a, tt.b)
+	}
+}
@@ -0,0 +1,323 @@
+package kdlconfig
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pathSegment is one step of a path into a config: a field name, a slice index or a map key.
+type pathSegment struct {
+	name  string
+	index int
+	key   string
+	kind  segmentKind
+}
+
+type segmentKind int
+
+const (
+	fieldSegment segmentKind = iota
+	indexSegment
+	keySegment
+)
+
+// parseConfigPath splits a path such as `database.replicas[0]` or `upstreams["eu"].port`
+// into its segments. Field names may be KDL node names or Go field names.
+func parseConfigPath(path string) ([]pathSegment, error) {
+	var segs []pathSegment
+	for i := 0; i < len(path); {
+		switch {
+		case path[i] == '.':
+			if i == 0 || i+1 == len(path) || path[i+1] == '.' || path[i+1] == '[' {
+				return nil, fmt.Errorf("invalid path %q: empty field name", path)
+			}
+			i++
+		case path[i] == '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: unterminated [", path)
+			}
+			inner := path[i+1 : i+end]
+			if strings.HasPrefix(inner, `"`) {
+				quoted, err := strconv.QuotedPrefix(path[i+1:])
+				if err != nil {
+					return nil, fmt.Errorf("invalid path %q: %w", path, err)
+				}
+				key, _ := strconv.Unquote(quoted)
+				end = 1 + len(quoted)
+				if i+end >= len(path) || path[i+end] != ']' {
+					return nil, fmt.Errorf("invalid path %q: expected ] after map key", path)
+				}
+				segs = append(segs, pathSegment{key: key, kind: keySegment})
+			} else {
+				n, err := strconv.Atoi(inner)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid path %q: bad index %q", path, inner)
+				}
+				segs = append(segs, pathSegment{index: n, kind: indexSegment})
+			}
+			i += end + 1
+		default:
+			end := strings.IndexAny(path[i:], ".[")
+			if end < 0 {
+				end = len(path) - i
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid path %q: empty field name", path)
+			}
+			segs = append(segs, pathSegment{name: path[i : i+end], kind: fieldSegment})
+			i += end
+		}
+	}
+	if len(segs) == 0 {
+		return nil, fmt.Errorf("invalid path %q: empty", path)
+	}
+	return segs, nil
+}
+
+// findField returns the index sequence of the field of struct type t called name,
+// by KDL node name or Go field name, looking into embedded structs.
+func findField(t reflect.Type, name string) ([]int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			if idx, ok := findField(sf.Type, name); ok {
+				return append([]int{i}, idx...), true
+			}
+			continue
+		}
+		if sf.Name == name || kdlFieldName(sf) == name {
+			return []int{i}, true
+		}
+	}
+	return nil, false
+}
+
+// pathType returns the type of the value at segs in a value of type t.
+func pathType(t reflect.Type, segs []pathSegment) (reflect.Type, error) {
+	for _, seg := range segs {
+		t = indirectType(t)
+		switch seg.kind {
+		case fieldSegment:
+			if t.Kind() != reflect.Struct {
+				return nil, fmt.Errorf("%s has no field %q", t, seg.name)
+			}
+			idx, ok := findField(t, seg.name)
+			if !ok {
+				return nil, fmt.Errorf("%s has no field %q", t, seg.name)
+			}
+			t = t.FieldByIndex(idx).Type
+		case indexSegment:
+			if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+				return nil, fmt.Errorf("%s cannot be indexed", t)
+			}
+			t = t.Elem()
+		case keySegment:
+			if t.Kind() != reflect.Map || t.Key().Kind() != reflect.String {
+				return nil, fmt.Errorf("%s has no string keys", t)
+			}
+			t = t.Elem()
+		}
+	}
+	return t, nil
+}
+
+// pathValue returns the value at segs in v, or false if it is absent: behind a nil
+// pointer, past the end of a slice or under a missing map key.
+func pathValue(v reflect.Value, segs []pathSegment) (reflect.Value, bool) {
+	for _, seg := range segs {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		switch seg.kind {
+		case fieldSegment:
+			idx, ok := findField(v.Type(), seg.name)
+			if !ok {
+				return reflect.Value{}, false
+			}
+			for _, i := range idx {
+				v = v.Field(i)
+			}
+		case indexSegment:
+			if seg.index >= v.Len() {
+				return reflect.Value{}, false
+			}
+			v = v.Index(seg.index)
+		case keySegment:
+			v = v.MapIndex(reflect.ValueOf(seg.key).Convert(v.Type().Key()))
+			if !v.IsValid() {
+				return reflect.Value{}, false
+			}
+		}
+	}
+	return v, true
+}
+
+// Extract returns the value at path in cfg, a pointer to a config struct, as *T.
+// path is a KDL path (`database.replicas[0]`, `upstreams["eu"]`) or the matching Go path
+// (`Database.Replicas[0]`). T is the type of the value, or the type it points to.
+//
+// The result points into cfg when the value is addressable and is a copy otherwise
+// (map entries); either way it must be treated as read-only. If the value is absent
+// (behind a nil pointer, past the end of a slice or under a missing key), Extract
+// returns nil. It fails if the path does not exist in the type of cfg or does not
+// lead to a T.
+func Extract[T any](cfg any, path string) (*T, error) {
+	segs, err := parseConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPathType[T](reflect.TypeOf(cfg), segs); err != nil {
+		return nil, err
+	}
+	v, ok := pathValue(reflect.ValueOf(cfg), segs)
+	if !ok {
+		return nil, nil
+	}
+	return pointerTo[T](v), nil
+}
+
+// checkPathType makes sure that the value at segs in a value of type t is a T or *T.
+func checkPathType[T any](t reflect.Type, segs []pathSegment) error {
+	pt, err := pathType(t, segs)
+	if err != nil {
+		return err
+	}
+	want := reflect.TypeOf((*T)(nil)).Elem()
+	if pt != want && pt != reflect.PtrTo(want) {
+		return fmt.Errorf("value at path is %s, not %s", pt, want)
+	}
+	return nil
+}
+
+// pointerTo returns v, a T or *T, as *T.
+func pointerTo[T any](v reflect.Value) *T {
+	if p, ok := v.Interface().(*T); ok {
+		return p
+	}
+	if v.CanAddr() {
+		return v.Addr().Interface().(*T)
+	}
+	c := new(T)
+	reflect.ValueOf(c).Elem().Set(v)
+	return c
+}
+
+// Subscription is a callback registered with Watcher.Subscribe.
+type Subscription struct {
+	w  *Watcher
+	id uint64
+}
+
+// Unsubscribe stops the callback from being called. It is safe to call more than once.
+func (s *Subscription) Unsubscribe() {
+	s.w.subsMu.Lock()
+	defer s.w.subsMu.Unlock()
+	delete(s.w.subs, s.id)
+}
+
+// subscriber is a callback for the value at path; absent values are passed as invalid.
+type subscriber struct {
+	path []pathSegment
+	fn   func(old, new reflect.Value)
+}
+
+// Subscribe registers fn to be called whenever the value at path changes, as decided by
+// reflect.DeepEqual; reloads that leave it alone do not call fn. path is a KDL or Go
+// path as accepted by Extract, e.g. "database". old and new are the values before and
+// after the change, nil when absent.
+//
+// Callbacks are called after onChange, in the same way (see WithSyncDelivery), in the
+// order they were registered; any number may be registered for the same path.
+// It fails if the path does not exist in the type of the config.
+func (w *Watcher) Subscribe(path string, fn func(old, new any)) (*Subscription, error) {
+	segs, err := parseConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pathType(reflect.TypeOf(w.prototype), segs); err != nil {
+		return nil, err
+	}
+	return w.subscribe(segs, func(old, new reflect.Value) {
+		fn(interfaceOf(old), interfaceOf(new))
+	}), nil
+}
+
+// Subscribe registers fn with w like Watcher.Subscribe, passing the values at path as
+// *T (see Extract for how they are obtained):
+//
+//	sub, err := kdlconfig.Subscribe(watcher, "database", func(old, new *DatabaseConfig) {
+//		pool.Reconnect(new)
+//	})
+//
+// It fails if the path does not exist in the type of the config or does not lead to a T.
+func Subscribe[T any](w *Watcher, path string, fn func(old, new *T)) (*Subscription, error) {
+	segs, err := parseConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPathType[T](reflect.TypeOf(w.prototype), segs); err != nil {
+		return nil, err
+	}
+	return w.subscribe(segs, func(old, new reflect.Value) {
+		var o, n *T
+		if old.IsValid() {
+			o = pointerTo[T](old)
+		}
+		if new.IsValid() {
+			n = pointerTo[T](new)
+		}
+		fn(o, n)
+	}), nil
+}
+
+func (w *Watcher) subscribe(segs []pathSegment, fn func(old, new reflect.Value)) *Subscription {
+	w.subsMu.Lock()
+	defer w.subsMu.Unlock()
+	if w.subs == nil {
+		w.subs = make(map[uint64]*subscriber)
+	}
+	w.nextSubID++
+	w.subs[w.nextSubID] = &subscriber{path: segs, fn: fn}
+	return &Subscription{w: w, id: w.nextSubID}
+}
+
+// notifySubscribers calls the subscribers whose value differs between old and new.
+func (w *Watcher) notifySubscribers(old, new any) {
+	w.subsMu.Lock()
+	ids := make([]uint64, 0, len(w.subs))
+	for id := range w.subs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	subs := make([]*subscriber, len(ids))
+	for i, id := range ids {
+		subs[i] = w.subs[id]
+	}
+	w.subsMu.Unlock()
+
+	for _, s := range subs {
+		ov, oldOK := pathValue(reflect.ValueOf(old), s.path)
+		nv, newOK := pathValue(reflect.ValueOf(new), s.path)
+		if oldOK == newOK && (!oldOK || reflect.DeepEqual(ov.Interface(), nv.Interface())) {
+			continue
+		}
+		s.fn(ov, nv)
+	}
+}
+
+func interfaceOf(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
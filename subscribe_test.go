@@ -0,0 +1,150 @@
+package kdlconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type subscribeDatabase struct {
+	Host string `kdl:"host"`
+	Port int    `kdl:"port"`
+}
+
+type subscribeConfig struct {
+	Database  subscribeDatabase            `kdl:"database"`
+	Cache     *subscribeDatabase           `kdl:"cache"`
+	Log       struct{ Level string }       `kdl:"log"`
+	Replicas  []subscribeDatabase          `kdl:"replica,multiple"`
+	Upstreams map[string]subscribeDatabase `kdl:"upstreams"`
+}
+
+func TestParseConfigPath(t *testing.T) {
+	segs, err := parseConfigPath(`upstreams["e.u"].replicas[2].port`)
+	require.NoError(t, err)
+	require.Equal(t, []pathSegment{
+		{name: "upstreams", kind: fieldSegment},
+		{key: "e.u", kind: keySegment},
+		{name: "replicas", kind: fieldSegment},
+		{index: 2, kind: indexSegment},
+		{name: "port", kind: fieldSegment},
+	}, segs)
+
+	for _, bad := range []string{"", ".a", "a.", "a..b", "a.[0]", "a[", "a[x]", "a[-1]", `a["x"`, `a["x"y]`} {
+		_, err := parseConfigPath(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	cfg := &subscribeConfig{
+		Database:  subscribeDatabase{Host: "db", Port: 5432},
+		Replicas:  []subscribeDatabase{{Host: "r0"}},
+		Upstreams: map[string]subscribeDatabase{"eu": {Host: "eu"}},
+	}
+	cfg.Log.Level = "info"
+
+	db, err := Extract[subscribeDatabase](cfg, "database")
+	require.NoError(t, err)
+	require.Same(t, &cfg.Database, db)
+
+	port, err := Extract[int](cfg, "Database.Port")
+	require.NoError(t, err)
+	require.Equal(t, 5432, *port)
+
+	level, err := Extract[string](cfg, "log.level")
+	require.NoError(t, err)
+	require.Equal(t, "info", *level)
+
+	replica, err := Extract[subscribeDatabase](cfg, "replica[0]")
+	require.NoError(t, err)
+	require.Equal(t, "r0", replica.Host)
+
+	eu, err := Extract[subscribeDatabase](cfg, `upstreams["eu"]`)
+	require.NoError(t, err)
+	require.Equal(t, "eu", eu.Host)
+
+	// absent values
+	cache, err := Extract[subscribeDatabase](cfg, "cache")
+	require.NoError(t, err)
+	require.Nil(t, cache)
+	missing, err := Extract[subscribeDatabase](cfg, `upstreams["us"]`)
+	require.NoError(t, err)
+	require.Nil(t, missing)
+	cachePort, err := Extract[int](cfg, "cache.port")
+	require.NoError(t, err)
+	require.Nil(t, cachePort)
+
+	_, err = Extract[int](cfg, "database.prot")
+	require.Error(t, err)
+	_, err = Extract[string](cfg, "database.port")
+	require.Error(t, err)
+}
+
+func TestWatcher_Subscribe(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	}
+	write("database {\n    host \"db\"\n    port 5432\n}\nlog {\n    level \"info\"\n}\n")
+
+	watcher, err := WatchTyped[subscribeConfig](file, nil, WithSyncDelivery())
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	type dbChange struct{ old, new *subscribeDatabase }
+	dbChanges := make(chan dbChange, 4)
+	dbSub, err := Subscribe(watcher.Watcher, "database", func(old, new *subscribeDatabase) {
+		dbChanges <- dbChange{old, new}
+	})
+	require.NoError(t, err)
+
+	levels := make(chan [2]any, 4)
+	_, err = watcher.Subscribe("log.level", func(old, new any) {
+		levels <- [2]any{old, new}
+	})
+	require.NoError(t, err)
+
+	caches := make(chan dbChange, 4)
+	_, err = Subscribe(watcher.Watcher, "cache", func(old, new *subscribeDatabase) {
+		caches <- dbChange{old, new}
+	})
+	require.NoError(t, err)
+
+	waitVersion := func(v uint64) {
+		t.Helper()
+		require.Eventually(t, func() bool { return watcher.Version() >= v }, 2*time.Second, 5*time.Millisecond)
+	}
+
+	// only the log level changes
+	write("database {\n    host \"db\"\n    port 5432\n}\nlog {\n    level \"debug\"\n}\n")
+	waitVersion(2)
+	require.Equal(t, [2]any{"info", "debug"}, <-levels)
+	require.Empty(t, dbChanges)
+
+	// the database and the cache change
+	write("database {\n    host \"db\"\n    port 6543\n}\nlog {\n    level \"debug\"\n}\ncache {\n    host \"redis\"\n}\n")
+	waitVersion(3)
+	change := <-dbChanges
+	require.Equal(t, 5432, change.old.Port)
+	require.Equal(t, 6543, change.new.Port)
+	cache := <-caches
+	require.Nil(t, cache.old)
+	require.Equal(t, "redis", cache.new.Host)
+	require.Empty(t, levels)
+
+	// after unsubscribing, nothing is delivered
+	dbSub.Unsubscribe()
+	dbSub.Unsubscribe()
+	write("database {\n    host \"db\"\n    port 7000\n}\nlog {\n    level \"debug\"\n}\n")
+	waitVersion(4)
+	require.Empty(t, dbChanges)
+
+	_, err = watcher.Subscribe("databse", func(old, new any) {})
+	require.Error(t, err)
+	_, err = Subscribe(watcher.Watcher, "database", func(old, new *string) {})
+	require.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package kdlconfig
+
+import (
+	"context"
+	"time"
+)
+
+// Load reads the config file at path into a new T using a Loader configured with opts.
+// T must be a struct type.
+//
+//	cfg, err := kdlconfig.Load[Config]("config.kdl", kdlconfig.WithEnvPrefix("APP"))
+func Load[T any](path string, opts ...Option) (*T, error) {
+	cfg := new(T)
+	if err := NewLoader(opts...).Load(cfg, path); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// TypedWatcher is a Watcher whose configs are of type *T.
+// All Watcher methods are available on it; Current, Snapshot and History are narrowed to *T.
+type TypedWatcher[T any] struct {
+	*Watcher
+}
+
+// WatchTyped creates and starts a Watcher for a config of type T.
+// onChange receives the config as *T, so no type assertion is needed; it may be nil.
+func WatchTyped[T any](path string, onChange func(newCfg *T), opts ...WatchOption) (*TypedWatcher[T], error) {
+	return WatchTypedContext(context.Background(), path, onChange, opts...)
+}
+
+// WatchTypedContext is like WatchTyped, but the Watcher also stops when ctx is done.
+func WatchTypedContext[T any](ctx context.Context, path string, onChange func(newCfg *T), opts ...WatchOption) (*TypedWatcher[T], error) {
+	w, err := WatchContext(ctx, path, new(T), func(newCfg any) {
+		if onChange != nil {
+			onChange(newCfg.(*T))
+		}
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedWatcher[T]{Watcher: w}, nil
+}
+
+// TypedSnapshot is a Snapshot whose config is of type *T.
+type TypedSnapshot[T any] struct {
+	Config   *T
+	Version  uint64
+	LoadedAt time.Time
+}
+
+// Current returns the most recently loaded config.
+func (w *TypedWatcher[T]) Current() *T {
+	return w.Watcher.Current().(*T)
+}
+
+// Snapshot returns the most recently loaded config with its version and load time.
+func (w *TypedWatcher[T]) Snapshot() TypedSnapshot[T] {
+	return typedSnapshot[T](w.Watcher.Snapshot())
+}
+
+// History returns the previous configs kept with WithHistory, most recent first.
+func (w *TypedWatcher[T]) History() []TypedSnapshot[T] {
+	history := w.Watcher.History()
+	out := make([]TypedSnapshot[T], len(history))
+	for i, s := range history {
+		out[i] = typedSnapshot[T](s)
+	}
+	return out
+}
+
+func typedSnapshot[T any](s Snapshot) TypedSnapshot[T] {
+	return TypedSnapshot[T]{Config: s.Config.(*T), Version: s.Version, LoadedAt: s.LoadedAt}
+}
@@ -0,0 +1,106 @@
+package kdlconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type typedConfig struct {
+	Name string `kdl:"name" validate:"required"`
+	Port int    `kdl:"port" default:"8080" validate:"min=1,max=65535"`
+}
+
+func TestLoad_Typed(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *typedConfig
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			content: "name \"api\"\nport 9000\n",
+			want:    &typedConfig{Name: "api", Port: 9000},
+		},
+		{
+			name:    "defaults applied",
+			content: "name \"api\"\n",
+			want:    &typedConfig{Name: "api", Port: 8080},
+		},
+		{
+			name:    "validation error",
+			content: "port 9000\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load[typedConfig](writeConfig(t, tt.content))
+			if tt.wantErr {
+				require.Error(t, err)
+				require.Nil(t, cfg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, cfg)
+		})
+	}
+}
+
+func TestLoad_TypedOptions(t *testing.T) {
+	fsys := fstest.MapFS{"app.kdl": {Data: []byte("name \"api\"\n")}}
+	t.Setenv("TYPED_PORT", "7000")
+
+	cfg, err := Load[typedConfig]("app.kdl", WithFS(fsys), WithEnvPrefix("TYPED"))
+	require.NoError(t, err)
+	require.Equal(t, &typedConfig{Name: "api", Port: 7000}, cfg)
+}
+
+func TestWatchTyped(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	ch := make(chan *watcherConfig, 2)
+	watcher, err := WatchTyped(file, func(newCfg *watcherConfig) {
+		ch <- newCfg
+	})
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	select {
+	case cfg := <-ch:
+		require.Equal(t, 1, cfg.Foo)
+	case <-time.After(time.Second):
+		t.Fatal("initial config not delivered")
+	}
+	require.Equal(t, &watcherConfig{Foo: 1}, watcher.Current())
+
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	select {
+	case cfg := <-ch:
+		require.Equal(t, 2, cfg.Foo)
+	case <-time.After(time.Second):
+		t.Fatal("updated config not delivered")
+	}
+	require.Equal(t, 2, watcher.Current().Foo)
+
+	snapshot := watcher.Snapshot()
+	require.Equal(t, &watcherConfig{Foo: 2}, snapshot.Config)
+	require.Equal(t, uint64(2), snapshot.Version)
+	require.False(t, snapshot.LoadedAt.IsZero())
+}
+
+func TestWatchTyped_InvalidInitialConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("port 0\n"), 0644))
+
+	watcher, err := WatchTyped[typedConfig](file, nil)
+	require.Error(t, err)
+	require.Nil(t, watcher)
+}
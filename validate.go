@@ -3,6 +3,7 @@ package kdlconfig
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/ykhdr/kdl-config/rules"
@@ -10,11 +11,31 @@ import (
 
 // ValidationError describes a single validation error.
 type ValidationError struct {
+	// Field is the full Go path of the field, e.g. "Database.Primary.Port".
+	// It is empty for unknown nodes and properties reported in strict mode.
 	Field string
-	Msg   string
+	// Path is the full KDL node path of the field, e.g. "database.primary.port".
+	Path string
+	// Pos is where the offending value was read from; it is only set by Loader.
+	Pos Position
+	Msg string
 }
 
 func (e ValidationError) Error() string {
+	if e.Pos != (Position{}) {
+		path := e.Path
+		if path == "" {
+			path = e.Field
+		}
+		return fmt.Sprintf("%s: %s: %s", e.Pos, path, e.Msg)
+	}
+	if e.Field == "" {
+		// errors about the document itself (see WithStrict) have no Go field
+		return fmt.Sprintf("validation failed on %q: %s", e.Path, e.Msg)
+	}
+	if e.Path != "" && e.Path != e.Field {
+		return fmt.Sprintf("validation failed on %q (%s): %s", e.Path, e.Field, e.Msg)
+	}
 	return fmt.Sprintf("validation failed on %q: %s", e.Field, e.Msg)
 }
 
@@ -32,10 +53,26 @@ func (es ValidationErrors) Error() string {
 	return b.String()
 }
 
-// validateStruct iterates over the fields of the cfg structure (pointer to struct),
-// reads from the struct tag rawTag := ft.Tag.Get("validate"),
-// then for each rule calls rules.GetRule(rawRule) and invokes rule.Validate().
+// validator validates config structs against the rules declared in their struct tags.
+// The zero value uses the "validate" tag and the default rule registry.
+type validator struct {
+	// tagName is the struct tag holding the rules; "validate" if empty.
+	tagName string
+	// registry resolves rule names; rules.DefaultRegistry() if nil.
+	registry *rules.Registry
+	// rules holds rule factories that take precedence over the registry.
+	rules map[string]rules.RuleFactory
+}
+
+// validateStruct validates cfg using the "validate" tag and the default rule registry.
 func validateStruct(cfg any) error {
+	return (&validator{}).validateStruct(cfg)
+}
+
+// validateStruct iterates over the fields of the cfg structure (pointer to struct),
+// parses the struct tag rawTag := ft.Tag.Get(vd.tagName) with rules.ParseTag,
+// then for each rule calls vd.getRule(rawRule) and invokes rule.Validate().
+func (vd *validator) validateStruct(cfg any) error {
 	// First, register all built-in rules (with a single call, idempotent).
 	rules.RegisterDefaultRules()
 
@@ -47,75 +84,213 @@ func validateStruct(cfg any) error {
 		return fmt.Errorf("validateStruct: expected struct, got %T", v.Interface())
 	}
 
-	visited := make(map[uintptr]bool)
+	visited := make(map[visitKey]bool)
 	// do not mark root struct address as visited for struct-field recursion
-	if err := validateStructFields(v, visited); err != nil {
-		return err
+	if errs := vd.validateStructFields(v.Elem(), fieldPath{}, visited); len(errs) > 0 {
+		return errs
 	}
 	return nil
 }
 
-// validateStructFields validates a pointer to struct with cycle detection.
-func validateStructFields(pv reflect.Value, visited map[uintptr]bool) error {
-	// pv must be a non-nil pointer to struct
-	if pv.Kind() != reflect.Ptr || pv.IsNil() || pv.Elem().Kind() != reflect.Struct {
-		return nil
+func (vd *validator) tag() string {
+	if vd.tagName == "" {
+		return "validate"
+	}
+	return vd.tagName
+}
+
+// getRule resolves a raw rule such as "min=5", preferring the validator's own rules.
+func (vd *validator) getRule(raw string) (rules.Rule, error) {
+	name, param, _ := strings.Cut(raw, "=")
+	if factory, ok := vd.rules[name]; ok {
+		return factory(param)
 	}
+	if vd.registry != nil {
+		return vd.registry.Get(raw)
+	}
+	return rules.GetRule(raw)
+}
 
+// visitKey identifies a pointer, slice or map that has already been descended into.
+// The type is part of the key because a struct and its first field share an address.
+type visitKey struct {
+	ptr uintptr
+	len int
+	typ reflect.Type
+}
+
+// validateStructFields validates the fields of struct value v.
+// path is the location of the struct within the root config and prefixes every reported error.
+func (vd *validator) validateStructFields(v reflect.Value, path fieldPath, visited map[visitKey]bool) ValidationErrors {
 	var allErrs ValidationErrors
-	v := pv.Elem()
 	t := v.Type()
 
 	for i := 0; i < v.NumField(); i++ {
 		sf := t.Field(i)
 		fv := v.Field(i)
+		fp := path.field(sf)
 
-		// Recursive descent into nested structs while avoiding cycles
-		switch fv.Kind() {
-		case reflect.Struct:
-			// Always recurse into embedded struct value; no cycle risk without pointers.
-			addr := fv.Addr()
-			if err := validateStructFields(addr, visited); err != nil {
-				if verrs, ok := err.(ValidationErrors); ok {
-					allErrs = append(allErrs, verrs...)
-				} else {
-					allErrs = append(allErrs, ValidationError{Field: sf.Name, Msg: err.Error()})
-				}
+		// Recursive descent into nested structs and collections of them
+		allErrs = append(allErrs, vd.validateNested(fv, fp, visited)...)
+
+		rawTag := sf.Tag.Get(vd.tag())
+		if rawTag != "" {
+			tag, err := rules.ParseTag(rawTag)
+			if err != nil {
+				allErrs = append(allErrs, newValidationError(fp, err))
+				continue
 			}
-		case reflect.Ptr:
-			if !fv.IsNil() && fv.Elem().Kind() == reflect.Struct {
-				ptr := fv.Pointer()
-				if !visited[ptr] {
-					visited[ptr] = true
-					if err := validateStructFields(fv, visited); err != nil {
-						if verrs, ok := err.(ValidationErrors); ok {
-							allErrs = append(allErrs, verrs...)
-						} else {
-							allErrs = append(allErrs, ValidationError{Field: sf.Name, Msg: err.Error()})
-						}
-					}
-				}
+			allErrs = append(allErrs, vd.applyTag(fv, sf, tag, fp)...)
+		}
+	}
+
+	return allErrs
+}
+
+// applyTag runs the rules of tag against v, then the key rules against each map key and
+// the element rules against each element of a slice, array or map. Keys and elements
+// that are non-nil pointers are dereferenced first; nil ones are left for required.
+func (vd *validator) applyTag(v reflect.Value, sf reflect.StructField, tag *rules.Tag, path fieldPath) ValidationErrors {
+	var errs ValidationErrors
+	for _, rawRule := range tag.Rules {
+		rule, err := vd.getRule(rawRule)
+		if err != nil {
+			errs = append(errs, newValidationError(path, err))
+			continue
+		}
+		if err := rule.Validate(v, sf); err != nil {
+			errs = append(errs, newValidationError(path, err))
+		}
+	}
+
+	if tag.Keys != nil {
+		if v.Kind() != reflect.Map {
+			errs = append(errs, newValidationError(path, fmt.Errorf("%s is only supported for maps, got %s", rules.KeysTag, v.Kind())))
+		} else {
+			for _, k := range sortedMapKeys(v) {
+				errs = append(errs, vd.applyTag(indirect(k), sf, tag.Keys, path.key(k))...)
 			}
 		}
+	}
 
-		rawTag := sf.Tag.Get("validate")
-		if rawTag != "" {
-			for _, rawRule := range strings.Split(rawTag, ",") {
-				rawRule = strings.TrimSpace(rawRule)
-				rule, err := rules.GetRule(rawRule)
-				if err != nil {
-					allErrs = append(allErrs, ValidationError{Field: sf.Name, Msg: err.Error()})
-					continue
-				}
-				if err := rule.Validate(fv, sf); err != nil {
-					allErrs = append(allErrs, ValidationError{Field: sf.Name, Msg: err.Error()})
-				}
+	if tag.Elem != nil {
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				errs = append(errs, vd.applyTag(indirect(v.Index(i)), sf, tag.Elem, path.index(i))...)
+			}
+		case reflect.Map:
+			for _, k := range sortedMapKeys(v) {
+				errs = append(errs, vd.applyTag(indirect(v.MapIndex(k)), sf, tag.Elem, path.key(k))...)
 			}
+		default:
+			errs = append(errs, newValidationError(path, fmt.Errorf("%s is only supported for slices, arrays and maps, got %s", rules.DiveTag, v.Kind())))
 		}
 	}
 
-	if len(allErrs) > 0 {
-		return allErrs
+	return errs
+}
+
+// validateNested looks through v for structs and validates them. Pointers and interfaces
+// are followed, slices, arrays and maps are walked element by element; pointers, slices
+// and maps are descended into at most once so cyclic structures terminate.
+func (vd *validator) validateNested(v reflect.Value, path fieldPath, visited map[visitKey]bool) ValidationErrors {
+	switch v.Kind() {
+	case reflect.Struct:
+		return vd.validateStructFields(v, path, visited)
+	case reflect.Ptr:
+		if v.IsNil() || !markVisited(v, visited) {
+			return nil
+		}
+		return vd.validateNested(v.Elem(), path, visited)
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return vd.validateNested(v.Elem(), path, visited)
+	case reflect.Slice:
+		if v.IsNil() || !markVisited(v, visited) {
+			return nil
+		}
+		return vd.validateElements(v, path, visited)
+	case reflect.Array:
+		return vd.validateElements(v, path, visited)
+	case reflect.Map:
+		if v.IsNil() || !markVisited(v, visited) {
+			return nil
+		}
+		var errs ValidationErrors
+		for _, k := range sortedMapKeys(v) {
+			errs = append(errs, vd.validateNested(v.MapIndex(k), path.key(k), visited)...)
+		}
+		return errs
+	default:
+		return nil
 	}
-	return nil
+}
+
+func (vd *validator) validateElements(v reflect.Value, path fieldPath, visited map[visitKey]bool) ValidationErrors {
+	if !mayContainStruct(v.Type().Elem()) {
+		return nil
+	}
+	var errs ValidationErrors
+	for i := 0; i < v.Len(); i++ {
+		errs = append(errs, vd.validateNested(v.Index(i), path.index(i), visited)...)
+	}
+	return errs
+}
+
+// markVisited records the pointer, slice or map v and reports whether it was not seen before.
+func markVisited(v reflect.Value, visited map[visitKey]bool) bool {
+	key := newVisitKey(v)
+	if visited[key] {
+		return false
+	}
+	visited[key] = true
+	return true
+}
+
+// newVisitKey returns the visitKey of the pointer, slice or map v.
+func newVisitKey(v reflect.Value) visitKey {
+	key := visitKey{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		key.len = v.Len()
+	}
+	return key
+}
+
+// mayContainStruct reports whether values of type t can hold a struct somewhere inside,
+// which lets validation skip walking large collections of scalars.
+func mayContainStruct(t reflect.Type) bool {
+	for {
+		switch t.Kind() {
+		case reflect.Struct, reflect.Interface, reflect.Map:
+			return true
+		case reflect.Ptr, reflect.Slice, reflect.Array:
+			t = t.Elem()
+		default:
+			return false
+		}
+	}
+}
+
+// indirect follows v through non-nil pointers, so that the rules see the value pointed to.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+// sortedMapKeys returns the keys of map v in a stable order so errors are reported deterministically.
+func sortedMapKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return keys
+}
+
+func newValidationError(path fieldPath, err error) ValidationError {
+	return ValidationError{Field: path.goPath, Path: path.kdlPath, Msg: err.Error()}
 }
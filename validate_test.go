@@ -209,3 +209,204 @@ func TestValidateStruct_SliceRequired(t *testing.T) {
 	errFilled := validateStruct(cfgFilled)
 	require.NoError(t, errFilled, "slice with elements should pass required")
 }
+
+type pathPrimary struct {
+	Port int `kdl:"port" validate:"max=65535"`
+}
+
+type pathDatabase struct {
+	Primary *pathPrimary `kdl:"primary"`
+}
+
+type pathCache struct {
+	Port int `validate:"max=65535"`
+}
+
+type pathConfig struct {
+	Database pathDatabase `kdl:"database"`
+	Cache    pathCache
+}
+
+func TestValidateStruct_NestedPaths(t *testing.T) {
+	setup()
+	cfg := &pathConfig{
+		Database: pathDatabase{Primary: &pathPrimary{Port: 70000}},
+		Cache:    pathCache{Port: 70000},
+	}
+	err := validateStruct(cfg)
+	require.Error(t, err)
+
+	verrs, ok := err.(ValidationErrors)
+	require.True(t, ok, "expected ValidationErrors, got %T", err)
+	require.Len(t, verrs, 2)
+
+	require.Equal(t, "Database.Primary.Port", verrs[0].Field)
+	require.Equal(t, "database.primary.port", verrs[0].Path)
+	require.Equal(t, "Cache.Port", verrs[1].Field)
+	require.Equal(t, "cache.port", verrs[1].Path)
+	require.Contains(t, err.Error(), `"database.primary.port" (Database.Primary.Port)`)
+}
+
+type collListener struct {
+	Addr string `kdl:"addr" validate:"required"`
+}
+
+type collUpstream struct {
+	Timeout int `kdl:"timeout" validate:"min=1"`
+}
+
+type collConfig struct {
+	Listeners []collListener           `kdl:"listeners,multiple"`
+	Upstreams map[string]*collUpstream `kdl:"upstreams"`
+	Fixed     [2]collListener
+	Any       interface{}
+}
+
+func TestValidateStruct_Collections(t *testing.T) {
+	setup()
+	cfg := &collConfig{
+		Listeners: []collListener{{Addr: ":80"}, {Addr: ":81"}, {}},
+		Upstreams: map[string]*collUpstream{
+			"us": {Timeout: 5},
+			"eu": {Timeout: 0},
+			"ap": nil,
+		},
+		Fixed: [2]collListener{{Addr: ":1"}, {}},
+		Any:   &collListener{},
+	}
+	err := validateStruct(cfg)
+	require.Error(t, err)
+
+	verrs, ok := err.(ValidationErrors)
+	require.True(t, ok, "expected ValidationErrors, got %T", err)
+
+	var paths []string
+	for _, e := range verrs {
+		paths = append(paths, e.Path)
+	}
+	require.Equal(t, []string{
+		"listeners[2].addr",
+		`upstreams["eu"].timeout`,
+		"fixed[1].addr",
+		"any.addr",
+	}, paths)
+	require.Equal(t, "Listeners[2].Addr", verrs[0].Field)
+	require.Equal(t, `Upstreams["eu"].Timeout`, verrs[1].Field)
+}
+
+type cyclicNode struct {
+	Name     string `validate:"required"`
+	Next     *cyclicNode
+	Children []*cyclicNode
+	Peers    map[string]*cyclicNode
+}
+
+func TestValidateStruct_CollectionCycles(t *testing.T) {
+	setup()
+	a := &cyclicNode{Name: "a"}
+	b := &cyclicNode{}
+	a.Next = b
+	b.Next = a
+	a.Children = []*cyclicNode{a, b}
+	b.Peers = map[string]*cyclicNode{"a": a, "b": b}
+
+	err := validateStruct(a)
+	require.Error(t, err)
+
+	verrs, ok := err.(ValidationErrors)
+	require.True(t, ok, "expected ValidationErrors, got %T", err)
+	// b is reachable along several paths but is validated exactly once
+	require.Len(t, verrs, 1)
+	require.Equal(t, "Next.Name", verrs[0].Field)
+}
+
+type diveStruct struct {
+	Names  []string          `validate:"required,dive,pattern=^[a-z]+$"`
+	Limits map[string]int    `validate:"keys,oneof=a|b,endkeys,dive,min=0"`
+	Matrix [][]int           `validate:"dive,len=2,dive,max=9"`
+	Ptrs   map[string]*int   `validate:"dive,required"`
+	Scalar int               `validate:"dive,min=1"`
+	Tags   map[string]string `validate:"keys,len=2,endkeys"`
+}
+
+func TestValidateStruct_Dive(t *testing.T) {
+	setup()
+	one := 1
+	cfg := &diveStruct{
+		Names:  []string{"ok", "Bad1"},
+		Limits: map[string]int{"a": 1, "c": -1},
+		Matrix: [][]int{{1, 2}, {3}, {4, 10}},
+		Ptrs:   map[string]*int{"x": &one, "y": nil},
+		Tags:   map[string]string{"ok": "1", "bad": "2"},
+	}
+	err := validateStruct(cfg)
+	require.Error(t, err)
+
+	verrs, ok := err.(ValidationErrors)
+	require.True(t, ok, "expected ValidationErrors, got %T", err)
+
+	// key and value errors of the same map entry share a path
+	got := make(map[string]string)
+	for _, e := range verrs {
+		got[e.Path] += e.Msg + ";"
+	}
+	// the container rule holds: Names has elements
+	require.NotContains(t, got, "names")
+	require.Contains(t, got["names[1]"], "does not match pattern")
+	require.Contains(t, got[`limits["c"]`], "does not match any of the options")
+	require.Contains(t, got[`limits["c"]`], "value -1 < min 0")
+	require.NotContains(t, got, `limits["a"]`)
+	require.Contains(t, got["matrix[1]"], "length 1 != 2")
+	require.Contains(t, got["matrix[2][1]"], "value 10 > max 9")
+	require.Contains(t, got[`ptrs["y"]`], "required")
+	require.Contains(t, got["scalar"], "dive is only supported")
+	require.Contains(t, got[`tags["bad"]`], "length 3 != 2")
+	require.Len(t, verrs, 8)
+
+	// an empty Names fails the container rule
+	err = validateStruct(&diveStruct{})
+	verrs, ok = err.(ValidationErrors)
+	require.True(t, ok, "expected ValidationErrors, got %T", err)
+	require.Equal(t, "names", verrs[0].Path)
+	require.Contains(t, verrs[0].Msg, "required")
+}
+
+func TestValidateStruct_DivePointers(t *testing.T) {
+	setup()
+	str := func(s string) *string { return &s }
+	num := func(n int) *int { return &n }
+	cfg := &struct {
+		Names []*string        `validate:"dive,pattern=^[a-z]+$"`
+		Sizes []*int           `validate:"dive,min=5"`
+		Hosts map[*string]bool `validate:"keys,len=2,endkeys"`
+		Ports []*int           `validate:"dive,required"`
+	}{
+		Names: []*string{str("ok"), str("Bad1")},
+		Sizes: []*int{num(5), num(3)},
+		Hosts: map[*string]bool{str("ok"): true},
+		Ports: []*int{num(80), nil},
+	}
+	err := validateStruct(cfg)
+	require.Error(t, err)
+
+	verrs, ok := err.(ValidationErrors)
+	require.True(t, ok, "expected ValidationErrors, got %T", err)
+	require.Len(t, verrs, 3)
+	require.Equal(t, "names[1]", verrs[0].Path)
+	require.Contains(t, verrs[0].Msg, "does not match pattern")
+	require.Equal(t, "sizes[1]", verrs[1].Path)
+	require.Contains(t, verrs[1].Msg, "value 3 < min 5")
+	// nil elements are still reported by required
+	require.Equal(t, "ports[1]", verrs[2].Path)
+	require.Contains(t, verrs[2].Msg, "required")
+}
+
+func TestValidateStruct_InvalidTag(t *testing.T) {
+	setup()
+	cfg := &struct {
+		M map[string]int `validate:"keys,min=1"`
+	}{}
+	err := validateStruct(cfg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "keys without endkeys")
+}
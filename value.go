@@ -0,0 +1,88 @@
+package kdlconfig
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/sblinch/kdl-go"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// setValue parses raw according to the type of fv and stores the result in fv.
+//
+// Strings are taken verbatim, numbers and booleans are parsed with strconv, durations with
+// time.ParseDuration and types implementing encoding.TextUnmarshaler with UnmarshalText.
+// Everything else (slices, arrays, maps and structs) is parsed as the arguments, properties
+// and children of a KDL node, e.g. `1 2 3`, `"a" "b"`, `host="db" port=5432`.
+func setValue(fv reflect.Value, raw string) error {
+	if reflect.PtrTo(fv.Type()).Implements(textUnmarshalerType) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 0, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(raw, 0, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Ptr:
+		elem := reflect.New(fv.Type().Elem())
+		if err := setValue(elem.Elem(), raw); err != nil {
+			return err
+		}
+		fv.Set(elem)
+	default:
+		return setKDLValue(fv, raw)
+	}
+	return nil
+}
+
+// setKDLValue unmarshals raw as the body of a KDL node into fv.
+func setKDLValue(fv reflect.Value, raw string) error {
+	holder := reflect.New(reflect.StructOf([]reflect.StructField{{
+		Name: "V",
+		Type: fv.Type(),
+		Tag:  `kdl:"v"`,
+	}}))
+	if err := kdl.Unmarshal([]byte("v "+raw+"\n"), holder.Interface()); err != nil {
+		return fmt.Errorf("cannot parse %q as %s: %w", raw, fv.Type(), err)
+	}
+	fv.Set(holder.Elem().Field(0))
+	return nil
+}
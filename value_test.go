@@ -0,0 +1,56 @@
+package kdlconfig
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type valueTarget struct {
+	Host string `kdl:"host"`
+	Port int    `kdl:"port"`
+}
+
+func TestSetValue(t *testing.T) {
+	intPtr := 7
+	tests := []struct {
+		name    string
+		target  any
+		raw     string
+		want    any
+		wantErr bool
+	}{
+		{name: "string", target: new(string), raw: "hello world", want: "hello world"},
+		{name: "int", target: new(int), raw: "42", want: 42},
+		{name: "hex int", target: new(int64), raw: "0x10", want: int64(16)},
+		{name: "int overflow", target: new(int8), raw: "300", wantErr: true},
+		{name: "uint", target: new(uint16), raw: "8080", want: uint16(8080)},
+		{name: "float", target: new(float64), raw: "0.5", want: 0.5},
+		{name: "bool", target: new(bool), raw: "true", want: true},
+		{name: "duration", target: new(time.Duration), raw: "1m30s", want: 90 * time.Second},
+		{name: "bad duration", target: new(time.Duration), raw: "soon", wantErr: true},
+		{name: "pointer", target: new(*int), raw: "7", want: &intPtr},
+		{name: "text unmarshaler", target: new(net.IP), raw: "10.0.0.1", want: net.ParseIP("10.0.0.1")},
+		{name: "int slice", target: new([]int), raw: "1 2 3", want: []int{1, 2, 3}},
+		{name: "string slice", target: new([]string), raw: `"a" "b"`, want: []string{"a", "b"}},
+		{name: "struct props", target: new(valueTarget), raw: `host="db" port=5432`, want: valueTarget{Host: "db", Port: 5432}},
+		{name: "struct children", target: new(valueTarget), raw: `{ host "db"; port 1; }`, want: valueTarget{Host: "db", Port: 1}},
+		{name: "map", target: new(map[string]int), raw: "a=1 b=2", want: map[string]int{"a": 1, "b": 2}},
+		{name: "bad literal", target: new([]int), raw: "{", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fv := reflect.ValueOf(tt.target).Elem()
+			err := setValue(fv, tt.raw)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, fv.Interface())
+		})
+	}
+}
@@ -1,86 +1,301 @@
 package kdlconfig
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
-// Watcher monitors changes to a KDL file and automatically reloads it.
+// Watcher monitors changes to a KDL file, or a set of them, and automatically reloads it.
+//
+// It watches the directories holding the config files rather than the files themselves,
+// so that it keeps working when a file is replaced instead of written in place: editors
+// that save by renaming a temporary file over the original, and Kubernetes ConfigMap
+// volumes, where the file is a symlink into a `..data` directory that is swapped on update.
+// Where fsnotify is not available, it polls those directories instead, see WithPolling.
 type Watcher struct {
-	path       string
-	prototype  any
-	onChange   func(newCfg any)
-	loader     *Loader
-	currentMux sync.RWMutex
-	current    any
-	watcher    *fsnotify.Watcher
-	stopCh     chan struct{}
-}
-
-// Watch creates and starts a Watcher.
-//   - path: path to the config file.
+	path string
+	// fragments holds the files, directories and patterns merged after path, see WithFragments.
+	fragments []string
+	prototype any
+	onChange  func(newCfg any)
+	loader    *Loader
+	current   atomic.Pointer[Snapshot]
+	watcher   *fsnotify.Watcher
+	logger    Logger
+	onError   func(error)
+	debounce  time.Duration
+	throttle  time.Duration
+	clock     clock
+	// failures counts the reloads that failed since the last successful one.
+	failures int
+	// files maps every config file to the file it resolves to through symlinks, and names
+	// holds both; dirs holds the watched directories. They are only touched by reload and
+	// the loop goroutine, which never run at the same time.
+	files map[string]string
+	names map[string]bool
+	dirs  map[string]bool
+	// patterns holds the glob patterns the config files were expanded from, so that
+	// files being added are noticed. Like files, it is set by reload.
+	patterns []string
+
+	// pollInterval is set when the Watcher polls instead of using fsnotify, in which case
+	// watcher is nil; pollStates and polled hold the result of the previous scan.
+	pollInterval time.Duration
+	pollStates   map[string]fileState
+	polled       map[string]bool
+	// manual turns off both fsnotify and polling, see WithManualReload.
+	manual bool
+	// signals are the signals that trigger a reload, see WithReloadSignal; sigCh receives them.
+	signals []os.Signal
+	sigCh   chan os.Signal
+	// reloadCh hands the loop the reloads requested by Reload, with a channel for the result.
+	reloadCh chan chan error
+	// loads counts the reloads started and applied is the number of the last one that
+	// went live, so that a reload can tell it was overtaken by one requested from the
+	// BeforeApply hook. They are only touched by reload.
+	loads   uint64
+	applied uint64
+
+	beforeApply func(old, new any) error
+	// applyMu serializes changes to current and history, made by reloads and Rollback.
+	// Neither the BeforeApply hook nor the callbacks run while it is held.
+	applyMu sync.Mutex
+	// history holds the configs that were replaced, most recent last, up to historySize.
+	history     []*Snapshot
+	historySize int
+
+	// syncDelivery makes reload call onChange itself, see WithSyncDelivery. Otherwise
+	// reload leaves the config in next and signals notify, and the dispatch goroutine
+	// delivers the latest config once the previous callback has returned.
+	syncDelivery bool
+	// deliverMu serializes the callbacks under WithSyncDelivery; deliveredVersion is the
+	// version of the config they were last called for.
+	deliverMu        sync.Mutex
+	deliveredVersion uint64
+	next             atomic.Pointer[Snapshot]
+	notify           chan struct{}
+	onDiff           func(old, new any, changes []Change)
+	// delivered is the config most recently passed to the callbacks.
+	delivered any
+	subsMu    sync.Mutex
+	subs      map[uint64]*subscriber
+	nextSubID uint64
+	// loopDone is closed when the loop exits, dispatched when dispatch does.
+	loopDone   chan struct{}
+	dispatched chan struct{}
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	// done is closed once the loop has exited and the callbacks have returned.
+	done chan struct{}
+}
+
+// defaultDebounce is how long a Watcher waits for events to settle, see WithDebounce.
+const defaultDebounce = 100 * time.Millisecond
+
+// Watch creates and starts a Watcher. Files included by the config are watched as
+// well, and the set of watched files follows the includes on every reload.
+//   - path: path to the config file. A directory stands for the *.kdl files in it, and a
+//     glob pattern such as "/etc/app/conf.d/*.kdl" for the files it matches; the files
+//     are merged in lexical order, and files being added or removed cause a reload.
 //   - prototype: pointer to an empty struct of the same shape that will be loaded.
 //   - onChange: callback that is called on the first successful load and after each successful reload.
-func Watch(path string, prototype any, onChange func(newCfg any)) (*Watcher, error) {
-	w, err := fsnotify.NewWatcher()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create fsnotify watcher: %w", err)
-	}
+//     Calls are made one at a time and in order; see WithSyncDelivery.
+//   - opts: options configuring the Watcher, see WatchOption.
+//
+// If the initial load fails, its error is returned and no Watcher is started. Later
+// failures keep the previous config in use and are reported to the error handler set
+// with WithErrorHandler, as *ReloadError.
+func Watch(path string, prototype any, onChange func(newCfg any), opts ...WatchOption) (*Watcher, error) {
+	return WatchContext(context.Background(), path, prototype, onChange, opts...)
+}
 
+// WatchContext is like Watch, but the Watcher also stops when ctx is done.
+func WatchContext(ctx context.Context, path string, prototype any, onChange func(newCfg any), opts ...WatchOption) (*Watcher, error) {
 	watcher := &Watcher{
-		path:      path,
-		prototype: prototype,
-		onChange:  onChange,
-		loader:    NewLoader(),
-		stopCh:    make(chan struct{}),
+		path:       path,
+		prototype:  prototype,
+		onChange:   onChange,
+		loader:     NewLoader(),
+		debounce:   defaultDebounce,
+		clock:      realClock{},
+		dirs:       make(map[string]bool),
+		notify:     make(chan struct{}, 1),
+		reloadCh:   make(chan chan error),
+		loopDone:   make(chan struct{}),
+		dispatched: make(chan struct{}),
+		stopCh:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(watcher)
+	}
+	if watcher.manual {
+		watcher.pollInterval = 0
+	} else if watcher.pollInterval == 0 {
+		w, err := newFSWatcher()
+		if err != nil {
+			// e.g. inotify is not supported or its limits are exhausted
+			watcher.log().Warn("falling back to polling for config changes", "path", path, "interval", defaultPollInterval, "error", err)
+			watcher.pollInterval = defaultPollInterval
+		} else {
+			watcher.watcher = w
+		}
 	}
 
 	// Immediately load the config and call the callback
 	if err := watcher.reload(); err != nil {
-		_ = w.Close()
+		watcher.closeFSWatcher()
 		return nil, err
 	}
-
-	if err := w.Add(path); err != nil {
-		_ = w.Close()
-		return nil, fmt.Errorf("failed to watch file %q: %w", path, err)
+	if watcher.pollInterval > 0 {
+		// record the files as they are, so that only later changes are picked up
+		watcher.poll()
+	}
+	if len(watcher.signals) > 0 {
+		watcher.sigCh = make(chan os.Signal, 1)
+		signal.Notify(watcher.sigCh, watcher.signals...)
 	}
-	watcher.watcher = w
 
-	go watcher.loop()
+	if watcher.syncDelivery {
+		close(watcher.dispatched)
+	} else {
+		go watcher.dispatch()
+	}
+	go watcher.loop(ctx)
 	return watcher, nil
 }
 
-// loop listens for fsnotify events and reloads the config when the file changes.
-func (w *Watcher) loop() {
-	defer func() { _ = w.watcher.Close() }()
-	debounce := time.NewTimer(0)
-	<-debounce.C
+// newFSWatcher creates the fsnotify watcher; tests replace it to exercise the fallback
+// to polling.
+var newFSWatcher = fsnotify.NewWatcher
+
+// loop listens for fsnotify events, or polls the files, and reloads the config when
+// a file changes. Changes are debounced: the reload happens once no change was seen
+// for w.debounce, and no sooner than w.throttle after the previous one. Reloads
+// triggered by Reload and signals happen right away.
+func (w *Watcher) loop(ctx context.Context) {
+	defer func() {
+		if w.sigCh != nil {
+			signal.Stop(w.sigCh)
+		}
+		w.closeFSWatcher()
+		close(w.loopDone)
+		<-w.dispatched
+		close(w.done)
+	}()
+
+	pending := w.clock.NewTimer()
+	defer pending.Stop()
+	lastReload := w.clock.Now()
+
+	// nil channels never deliver, leaving out the mode not in use
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+		polls  <-chan time.Time
+	)
+	poll := w.clock.NewTimer()
+	defer poll.Stop()
+	if w.watcher != nil {
+		events, errs = w.watcher.Events, w.watcher.Errors
+	} else if w.pollInterval > 0 {
+		poll.Reset(w.pollInterval)
+		polls = poll.C()
+	}
 
 	for {
 		select {
-		case event := <-w.watcher.Events:
-			if event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+		case event := <-events:
+			if w.affects(event) {
 				// debouncing rapid events
-				debounce.Reset(100 * time.Millisecond)
+				pending.Reset(w.debounce)
+			}
+		case <-polls:
+			if w.poll() {
+				pending.Reset(w.debounce)
+			}
+			poll.Reset(w.pollInterval)
+		case <-pending.C():
+			if wait := w.throttle - w.clock.Now().Sub(lastReload); wait > 0 {
+				pending.Reset(wait)
+				continue
+			}
+			lastReload = w.clock.Now()
+			if err := w.reloadLogged("file change"); err != nil {
+				w.reportError(err)
 			}
-		case <-debounce.C:
-			if err := w.reload(); err != nil {
-				// here we can log the error, but not stop the watcher
-				fmt.Printf("config reload error: %v\n", err)
+		case sig := <-w.sigCh:
+			lastReload = w.clock.Now()
+			if err := w.reloadLogged(sig.String()); err != nil {
+				w.reportError(err)
 			}
-		case err := <-w.watcher.Errors:
-			fmt.Printf("watcher error: %v\n", err)
+		case reply := <-w.reloadCh:
+			lastReload = w.clock.Now()
+			reply <- w.reloadLogged("Reload")
+		case err := <-errs:
+			w.log().Error("config watch failed", "path", w.path, "error", err)
+			w.reportError(fmt.Errorf("failed to watch config %q: %w", w.path, err))
 		case <-w.stopCh:
 			return
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
+// ErrStopped is returned by Reload once the Watcher has stopped.
+var ErrStopped = errors.New("watcher stopped")
+
+// Reload reloads the config right away, regardless of debouncing and throttling, and
+// returns the outcome: nil once the new config is in use, or a *ReloadError wrapping the
+// error returned by the Loader or the BeforeApply hook, in which case the previous config
+// stays in use. The error is not reported to the error handler.
+//
+// Reload waits for a reload in progress to finish first, unless that one is waiting for
+// the BeforeApply hook or the error handler: the reload then happens right away, so that
+// they may call Reload, and a reload it overtakes is dropped. Reload returns before
+// onChange is called, unless WithSyncDelivery is used; then it must not be called from
+// onChange.
+func (w *Watcher) Reload() error {
+	reply := make(chan error, 1)
+	select {
+	case w.reloadCh <- reply:
+		return <-reply
+	case <-w.loopDone:
+		return ErrStopped
+	}
+}
+
+// reloadLogged reloads the config, logging and counting failures. trigger tells what
+// caused the reload.
+func (w *Watcher) reloadLogged(trigger string) error {
+	if err := w.reload(); err != nil {
+		// the previous config stays in use
+		w.failures++
+		w.log().Error("config reload failed", "path", w.path, "trigger", trigger, "failures", w.failures, "error", err)
+		return &ReloadError{Path: w.path, Failures: w.failures, Err: err}
+	}
+	w.failures = 0
+	if w.pollInterval > 0 {
+		// the files were just read: a change polling has yet to see is no reason to reload
+		w.poll()
+	}
+	w.log().Info("config reloaded", "path", w.path, "trigger", trigger, "version", w.Version())
+	return nil
+}
+
 // reload reads and validates the new config, saves it and calls onChange.
 func (w *Watcher) reload() error {
 	// Clone the prototype to avoid overwriting the old instance
@@ -89,22 +304,381 @@ func (w *Watcher) reload() error {
 		return fmt.Errorf("failed to clone prototype: %w", err)
 	}
 
-	if err := w.loader.Load(newCfg, w.path); err != nil {
+	files, patterns, err := expandPaths(append([]string{w.path}, w.fragments...))
+	if err != nil {
+		return err
+	}
+	src, err := w.loader.loadFragments(newCfg, files)
+	if err != nil {
+		return err
+	}
+	w.patterns = patterns
+	if err := w.watchFiles(append(files, src.includes...)); err != nil {
 		return err
 	}
 
-	w.currentMux.Lock()
-	w.current = newCfg
-	w.currentMux.Unlock()
+	w.loads++
+	load := w.loads
+	for {
+		// the hook runs unlocked, so that it may look at History, and through callOut, so
+		// that it may call Reload
+		prev := w.current.Load()
+		var err error
+		w.callOut(func() { err = w.approve(prev, newCfg) })
+		if err != nil {
+			return err
+		}
+		if w.applied > load {
+			// the hook reloaded the files itself, and that config is already in use
+			return nil
+		}
+		w.applyMu.Lock()
+		if w.current.Load() != prev {
+			// a Rollback got in first: the hook must approve the change from its config
+			w.applyMu.Unlock()
+			continue
+		}
+		if prev != nil && w.historySize > 0 {
+			w.history = append(w.history, prev)
+			if len(w.history) > w.historySize {
+				w.history = w.history[len(w.history)-w.historySize:]
+			}
+		}
+		w.setCurrent(newCfg)
+		w.applied = load
+		w.applyMu.Unlock()
+		w.deliverCurrent()
+		return nil
+	}
+}
+
+// ErrRejected is wrapped by the error returned when the BeforeApply hook (see
+// WithBeforeApply) rejects a config.
+var ErrRejected = errors.New("config rejected")
+
+// approve runs the BeforeApply hook on the change from prev to cfg.
+func (w *Watcher) approve(prev *Snapshot, cfg any) error {
+	if w.beforeApply == nil {
+		return nil
+	}
+	var old any
+	if prev != nil {
+		old = prev.Config
+	}
+	if err := w.beforeApply(old, cfg); err != nil {
+		return fmt.Errorf("%w: %w", ErrRejected, err)
+	}
+	return nil
+}
+
+// setCurrent makes cfg the current config and, unless WithSyncDelivery is used, hands
+// it over to dispatch. The caller must hold applyMu, and call deliverCurrent once it
+// has released it.
+func (w *Watcher) setCurrent(cfg any) {
+	var version uint64 = 1
+	if prev := w.current.Load(); prev != nil {
+		version = prev.Version + 1
+	}
+	w.current.Store(&Snapshot{Config: cfg, Version: version, LoadedAt: w.clock.Now()})
+
+	if w.syncDelivery {
+		return
+	}
+	// hand the config over to dispatch to avoid blocking watcher.loop; a config that
+	// was not delivered yet is superseded
+	w.next.Store(w.current.Load())
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// deliverCurrent calls the callbacks for the current config when WithSyncDelivery is
+// used. It runs without applyMu, so that the callbacks may call History; deliverMu keeps
+// the calls one at a time, and a config superseded in the meantime is skipped rather than
+// delivered after its successor.
+func (w *Watcher) deliverCurrent() {
+	if !w.syncDelivery {
+		return
+	}
+	w.deliverMu.Lock()
+	defer w.deliverMu.Unlock()
+	s := w.current.Load()
+	if s.Version <= w.deliveredVersion {
+		return
+	}
+	w.deliveredVersion = s.Version
+	w.notifyChange(s.Config)
+}
+
+// dispatch calls onChange for the configs reload hands over, one at a time and in order.
+// When the callback is slower than the reloads, only the latest config is delivered.
+// Once the loop has exited, the config still pending, if any, is delivered before
+// dispatch returns.
+func (w *Watcher) dispatch() {
+	defer close(w.dispatched)
+	for {
+		select {
+		case <-w.notify:
+			w.deliverPending()
+		case <-w.loopDone:
+			w.deliverPending()
+			return
+		}
+	}
+}
+
+// deliverPending delivers the pending config, if any.
+func (w *Watcher) deliverPending() {
+	if s := w.next.Swap(nil); s != nil {
+		w.notifyChange(s.Config)
+	}
+}
+
+// notifyChange calls the callbacks for cfg, diffing it against the config delivered
+// before. It is only called from one goroutine at a time.
+func (w *Watcher) notifyChange(cfg any) {
+	old := w.delivered
+	w.delivered = cfg
+	if w.onChange != nil {
+		w.onChange(cfg)
+	}
+	if old == nil {
+		return
+	}
+	if w.onDiff != nil {
+		if changes := Diff(old, cfg); len(changes) > 0 {
+			w.onDiff(old, cfg, changes)
+		}
+	}
+	w.notifySubscribers(old, cfg)
+}
 
-	// callback in a separate goroutine to avoid blocking watcher.loop
-	go w.onChange(newCfg)
+// affects reports whether event may have changed one of the config files.
+func (w *Watcher) affects(event fsnotify.Event) bool {
+	name := filepath.Clean(event.Name)
+	if w.dirs[name] && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		// the watch went away with the directory; the next reload adds it again
+		delete(w.dirs, name)
+	}
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+		return w.symlinkSwapped()
+	}
+	// a config file changed or a fragment was added
+	if w.isConfigFile(name) {
+		return true
+	}
+	return w.symlinkSwapped()
+}
+
+// symlinkSwapped reports whether a config file resolves to another file than it did.
+func (w *Watcher) symlinkSwapped() bool {
+	// a symlink on the way to a config file (such as Kubernetes' ..data) was swapped
+	for f, real := range w.files {
+		if evalSymlinks(f) != real {
+			return true
+		}
+	}
+	return false
+}
+
+// expandPaths returns the config files named by paths, in order: a directory is replaced
+// by the *.kdl files in it and a glob pattern by the files it matches, both sorted.
+// It also returns the patterns used, with directories turned into patterns. A directory
+// or pattern may match no file as long as some other path names one.
+func expandPaths(paths []string) (files, patterns []string, err error) {
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			p = filepath.Join(p, "*.kdl")
+		} else if !hasMeta(p) {
+			// a missing file is reported by the Loader
+			files = append(files, p)
+			continue
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid config pattern %q: %w", p, err)
+		}
+		// filepath.Glob returns the matches sorted
+		files = append(files, matches...)
+		patterns = append(patterns, p)
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no config files match %q", strings.Join(paths, ", "))
+	}
+	return files, patterns, nil
+}
+
+// hasMeta reports whether p contains any of the special characters of filepath.Match.
+func hasMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// watchFiles makes files the set of watched files. The directories holding them, and
+// those holding the files they resolve to through symlinks, are watched, as well as the
+// directories holding w.patterns; watches are added and removed as needed.
+func (w *Watcher) watchFiles(files []string) error {
+	w.files = make(map[string]string, len(files))
+	w.names = make(map[string]bool, 2*len(files))
+	want := make(map[string]bool)
+	for _, f := range files {
+		f = filepath.Clean(f)
+		real := evalSymlinks(f)
+		w.files[f] = real
+		w.names[f] = true
+		want[filepath.Dir(f)] = true
+		if real != "" && real != f {
+			w.names[real] = true
+			want[filepath.Dir(real)] = true
+		}
+	}
+	for _, p := range w.patterns {
+		if dir := filepath.Dir(p); !hasMeta(dir) {
+			want[dir] = true
+		}
+	}
+
+	for dir := range want {
+		if w.dirs[dir] {
+			continue
+		}
+		if w.watcher == nil {
+			// poll scans the directory
+			w.dirs[dir] = true
+			continue
+		}
+		if err := w.watcher.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch directory %q: %w", dir, err)
+		}
+		w.dirs[dir] = true
+	}
+	for dir := range w.dirs {
+		if !want[dir] {
+			if w.watcher != nil {
+				_ = w.watcher.Remove(dir)
+			}
+			delete(w.dirs, dir)
+		}
+	}
 	return nil
 }
 
-// Stop stops the watching and frees resources.
+// closeFSWatcher closes the fsnotify watcher, if the Watcher does not poll.
+func (w *Watcher) closeFSWatcher() {
+	if w.watcher != nil {
+		_ = w.watcher.Close()
+	}
+}
+
+// evalSymlinks returns p with all symlinks resolved, or "" if that fails.
+func evalSymlinks(p string) string {
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return ""
+	}
+	return real
+}
+
+// Snapshot is a config loaded by a Watcher, with its version and load time.
+// The config must be treated as read-only: it is shared by every reader.
+type Snapshot struct {
+	// Config is the loaded config, a pointer of the same type as the prototype.
+	Config any
+	// Version counts the successful loads; the initial load is version 1.
+	Version uint64
+	// LoadedAt is when the config was loaded.
+	LoadedAt time.Time
+}
+
+// Snapshot returns the most recently loaded config with its version and load time.
+// It does not lock and is safe to call from any number of goroutines, e.g. once per request.
+func (w *Watcher) Snapshot() Snapshot {
+	return *w.current.Load()
+}
+
+// Current returns the most recently loaded config. Like Snapshot, it does not lock.
+func (w *Watcher) Current() any {
+	return w.current.Load().Config
+}
+
+// Version returns the version of the most recently loaded config, see Snapshot.
+func (w *Watcher) Version() uint64 {
+	return w.current.Load().Version
+}
+
+// LoadedAt returns when the most recently loaded config was loaded.
+func (w *Watcher) LoadedAt() time.Time {
+	return w.current.Load().LoadedAt
+}
+
+// Stop stops the watching and frees resources. It waits until the Watcher's goroutines
+// have exited and the latest config has been delivered to onChange, so it must not be
+// called from onChange itself. Calling Stop more than once, or after the context passed to
+// WatchContext is done, is safe.
 func (w *Watcher) Stop() {
-	close(w.stopCh)
+	w.stopOnce.Do(func() { close(w.stopCh) })
+	<-w.done
+}
+
+// Done returns a channel that is closed once the Watcher has stopped, after Stop was
+// called or the context passed to WatchContext was done.
+func (w *Watcher) Done() <-chan struct{} {
+	return w.done
+}
+
+// ReloadError is reported to the error handler (see WithErrorHandler) when a config
+// changed on disk but could not be loaded, and returned by Reload when a requested
+// reload failed. The previous config stays in use.
+//
+// Err is the error returned by the Loader: use errors.As to get at the ValidationErrors
+// or *UnmarshalError it may hold.
+type ReloadError struct {
+	// Path is the config file being watched, as passed to Watch.
+	Path string
+	// Failures is the number of reloads that failed in a row, this one included.
+	Failures int
+	Err      error
+}
+
+func (e *ReloadError) Error() string {
+	return fmt.Sprintf("failed to reload config %q: %v", e.Path, e.Err)
+}
+
+func (e *ReloadError) Unwrap() error {
+	return e.Err
+}
+
+func (w *Watcher) reportError(err error) {
+	if w.onError != nil {
+		w.callOut(func() { w.onError(err) })
+	}
+}
+
+// callOut calls fn, which runs a user-supplied hook, on a goroutine of its own and serves
+// the reloads requested meanwhile, so that the hook may call Reload without waiting for
+// itself. It is called from the loop goroutine, or from Watch before the loop starts.
+func (w *Watcher) callOut(fn func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		case reply := <-w.reloadCh:
+			reply <- w.reloadLogged("Reload")
+		}
+	}
+}
+
+func (w *Watcher) log() Logger {
+	if w.logger == nil {
+		return w.loader.log()
+	}
+	return w.logger
 }
 
 // clonePrototype creates a new pointer to the same structure as the prototype.
@@ -0,0 +1,173 @@
+package kdlconfig
+
+import (
+	"os"
+	"time"
+)
+
+// WatchOption configures a Watcher.
+type WatchOption func(*Watcher)
+
+// WithLoader makes the Watcher load the config with l, so that it can use environment
+// overrides, a custom registry and any other Loader option. The Loader must read from
+// the operating system: a Loader created with WithFS cannot be watched. A nil Loader
+// is ignored, leaving the default one in place.
+func WithLoader(l *Loader) WatchOption {
+	return func(w *Watcher) {
+		if l != nil {
+			w.loader = l
+		}
+	}
+}
+
+// WithErrorHandler sets a function the Watcher reports the errors it runs into while
+// running to: failed reloads as *ReloadError, and failures of the underlying file watch.
+// The Watcher waits for the function, which should not block for long; it may call
+// Reload, whose own failures are returned rather than reported.
+func WithErrorHandler(fn func(error)) WatchOption {
+	return func(w *Watcher) {
+		w.onError = fn
+	}
+}
+
+// WithWatchLogger sets the Logger the Watcher reports reloads and errors to.
+// By default they go to the Loader's Logger (see WithLoader and WithLogger), if any.
+func WithWatchLogger(logger Logger) WatchOption {
+	return func(w *Watcher) {
+		w.logger = logger
+	}
+}
+
+// WithDebounce sets how long the Watcher waits for file events to settle before it
+// reloads, so that a burst of writes causes a single reload; the default is 100ms.
+func WithDebounce(d time.Duration) WatchOption {
+	return func(w *Watcher) {
+		w.debounce = d
+	}
+}
+
+// WithThrottle sets the minimum time between two reloads. Changes made sooner are
+// picked up by a reload once the interval has passed. There is no minimum by default.
+func WithThrottle(d time.Duration) WatchOption {
+	return func(w *Watcher) {
+		w.throttle = d
+	}
+}
+
+// withClock makes the Watcher use c instead of the system clock; it is used by tests.
+func withClock(c clock) WatchOption {
+	return func(w *Watcher) {
+		w.clock = c
+	}
+}
+
+// WithSyncDelivery makes the Watcher call onChange itself, before it looks at further
+// file events, instead of handing configs to a goroutine of their own. Every config is
+// then delivered, and a slow callback delays the next reload; in particular, Watch does
+// not return before the callback for the initial config has.
+//
+// By default callbacks run on a separate goroutine, still one at a time and in order;
+// when they are slower than the reloads, the configs in between are skipped and only
+// the latest is delivered.
+//
+// With sync delivery, onChange may call Current, Snapshot and History, but not Reload,
+// Rollback or Stop, which wait for the callback to return.
+func WithSyncDelivery() WatchOption {
+	return func(w *Watcher) {
+		w.syncDelivery = true
+	}
+}
+
+// WithBeforeApply sets a hook that can veto a config before it goes live, for checks
+// struct tags cannot express, such as whether a new listen address can be bound.
+// It is called with the current and the new config (old is nil for the initial load)
+// after the new one was loaded and validated. If it returns an error, the current config
+// stays in use and the error, wrapping ErrRejected, is handled like a failed reload.
+// The hook runs before the Watcher locks anything, so it may call Current and History.
+// It may also call Reload, which then takes the place of the reload that called the hook.
+func WithBeforeApply(fn func(old, new any) error) WatchOption {
+	return func(w *Watcher) {
+		w.beforeApply = fn
+	}
+}
+
+// WithHistory makes the Watcher keep the last n configs it replaced, so that Rollback
+// can return to them. No history is kept by default.
+func WithHistory(n int) WatchOption {
+	return func(w *Watcher) {
+		w.historySize = n
+	}
+}
+
+// WithDiffHandler sets a callback that receives, after every reload that changed the
+// config, the previous and the new config together with their Diff, so that a consumer
+// can react to the settings it cares about only:
+//
+//	kdlconfig.WithDiffHandler(func(old, new any, changes []kdlconfig.Change) {
+//		for _, c := range changes {
+//			if c.Path == "log.level" {
+//				setLevel(c.New.(string))
+//			}
+//		}
+//	})
+//
+// It is called right after onChange, in the same way (see WithSyncDelivery); old is
+// the config that was delivered before, so configs skipped by a slow callback are
+// included in the diff. It is not called for the initial load.
+func WithDiffHandler(fn func(old, new any, changes []Change)) WatchOption {
+	return func(w *Watcher) {
+		w.onDiff = fn
+	}
+}
+
+// WithFragments makes the Watcher merge the config files named by paths after the one
+// passed to Watch, in order. Like that one, each path may be a file, a directory standing
+// for the *.kdl files in it, or a glob pattern, so that a base config can be extended by
+// a conf.d-style directory:
+//
+//	kdlconfig.Watch("/etc/app/app.kdl", &Config{}, onChange,
+//		kdlconfig.WithFragments("/etc/app/conf.d/*.kdl"))
+//
+// The files are merged as if each was included in turn (see the include directive): later
+// arguments replace earlier ones and the occurrences of a `,multiple` node are kept from
+// every file. Adding, changing or removing any of the files causes a reload.
+func WithFragments(paths ...string) WatchOption {
+	return func(w *Watcher) {
+		w.fragments = append(w.fragments, paths...)
+	}
+}
+
+// WithPolling makes the Watcher look for changes by scanning the config files every
+// interval instead of relying on fsnotify, for filesystems that do not report changes,
+// such as NFS and other network mounts. A file counts as changed when its modification
+// time, size or contents differ. Changes are debounced like file events.
+//
+// The Watcher falls back to polling every second by itself when fsnotify cannot be set
+// up, e.g. because inotify watches are exhausted. A non-positive interval selects that
+// default as well.
+func WithPolling(interval time.Duration) WatchOption {
+	return func(w *Watcher) {
+		if interval <= 0 {
+			interval = defaultPollInterval
+		}
+		w.pollInterval = interval
+	}
+}
+
+// WithReloadSignal makes the Watcher reload the config whenever the process receives one
+// of sigs, typically syscall.SIGHUP. Such reloads happen right away and are reported like
+// those caused by file changes. The signals are no longer handled once the Watcher stops.
+func WithReloadSignal(sigs ...os.Signal) WatchOption {
+	return func(w *Watcher) {
+		w.signals = append(w.signals, sigs...)
+	}
+}
+
+// WithManualReload makes the Watcher leave the files alone: neither fsnotify nor polling
+// is used, and the config is only reloaded by Reload and the signals set with
+// WithReloadSignal.
+func WithManualReload() WatchOption {
+	return func(w *Watcher) {
+		w.manual = true
+	}
+}
@@ -1,11 +1,19 @@
 package kdlconfig
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/stretchr/testify/require"
 )
 
@@ -163,3 +171,944 @@ func TestWatcher_Stop(t *testing.T) {
 	default:
 	}
 }
+
+func TestWatcher_Includes(t *testing.T) {
+	type config struct {
+		Foo int `kdl:"foo"`
+		Bar int `kdl:"bar"`
+	}
+	dir := writeFiles(t, map[string]string{
+		"config.kdl": "foo 1\ninclude \"a.kdl\"\n",
+		"a.kdl":      "bar 1\n",
+		"b.kdl":      "bar 10\n",
+	})
+	file := filepath.Join(dir, "config.kdl")
+
+	ch := make(chan config, 4)
+	watcher, err := WatchTyped(file, func(cfg *config) {
+		ch <- *cfg
+	})
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	expect := func(want config) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			select {
+			case c := <-ch:
+				return c == want
+			default:
+				return false
+			}
+		}, time.Second, 10*time.Millisecond)
+	}
+	expect(config{Foo: 1, Bar: 1})
+
+	// a change to the included file triggers a reload
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.kdl"), []byte("bar 2\n"), 0644))
+	expect(config{Foo: 1, Bar: 2})
+
+	// switching the include over to another file starts watching that one
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\ninclude \"b.kdl\"\n"), 0644))
+	expect(config{Foo: 1, Bar: 10})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.kdl"), []byte("bar 11\n"), 0644))
+	expect(config{Foo: 1, Bar: 11})
+}
+
+// expectFoo waits for a callback on ch delivering Foo == want.
+func expectFoo(t *testing.T, ch <-chan watcherConfig, want int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		select {
+		case c := <-ch:
+			return c.Foo == want
+		default:
+			return false
+		}
+	}, 2*time.Second, 10*time.Millisecond, "config with foo %d not delivered", want)
+}
+
+func watchFoo(t *testing.T, file string) <-chan watcherConfig {
+	t.Helper()
+	ch := make(chan watcherConfig, 8)
+	watcher, err := Watch(file, &watcherConfig{}, func(newCfg any) {
+		ch <- *newCfg.(*watcherConfig)
+	})
+	require.NoError(t, err)
+	t.Cleanup(watcher.Stop)
+	return ch
+}
+
+func TestWatcher_AtomicRename(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+	ch := watchFoo(t, file)
+	expectFoo(t, ch, 1)
+
+	// save the way editors do: write a temporary file and rename it over the original
+	for i := 2; i <= 3; i++ {
+		tmp := filepath.Join(dir, ".config.kdl.swp")
+		require.NoError(t, os.WriteFile(tmp, []byte(fmt.Sprintf("foo %d\n", i)), 0644))
+		require.NoError(t, os.Rename(tmp, file))
+		expectFoo(t, ch, i)
+	}
+}
+
+func TestWatcher_RemoveAndRecreate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+	ch := watchFoo(t, file)
+	expectFoo(t, ch, 1)
+
+	require.NoError(t, os.Remove(file))
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	expectFoo(t, ch, 2)
+	require.NoError(t, os.WriteFile(file, []byte("foo 3\n"), 0644))
+	expectFoo(t, ch, 3)
+}
+
+func TestWatcher_ConfigMapSymlinkSwap(t *testing.T) {
+	// mimic a Kubernetes ConfigMap volume:
+	//   config.kdl -> ..data/config.kdl, ..data -> ..v1
+	dir := t.TempDir()
+	writeVersion := func(version string, foo int) {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, version), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, version, "config.kdl"), []byte(fmt.Sprintf("foo %d\n", foo)), 0644))
+	}
+	writeVersion("..v1", 1)
+	require.NoError(t, os.Symlink("..v1", filepath.Join(dir, "..data")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "config.kdl"), filepath.Join(dir, "config.kdl")))
+
+	ch := watchFoo(t, filepath.Join(dir, "config.kdl"))
+	expectFoo(t, ch, 1)
+
+	// the update swaps ..data atomically and removes the old version
+	for i, version := range []string{"..v2", "..v3"} {
+		writeVersion(version, i+2)
+		require.NoError(t, os.Symlink(version, filepath.Join(dir, "..data_tmp")))
+		require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+		require.NoError(t, os.RemoveAll(filepath.Join(dir, fmt.Sprintf("..v%d", i+1))))
+		expectFoo(t, ch, i+2)
+	}
+}
+
+func TestWatcher_Snapshot(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	before := time.Now()
+	watcher, err := Watch(file, &watcherConfig{}, func(any) {})
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	first := watcher.Snapshot()
+	require.Equal(t, &watcherConfig{Foo: 1}, first.Config)
+	require.Equal(t, uint64(1), first.Version)
+	require.False(t, first.LoadedAt.Before(before))
+	require.Equal(t, first.Config, watcher.Current())
+	require.Equal(t, uint64(1), watcher.Version())
+	require.Equal(t, first.LoadedAt, watcher.LoadedAt())
+
+	// readers never block on or race with reloads
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					if s := watcher.Snapshot(); s.Config == nil {
+						t.Error("snapshot without config")
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	require.Eventually(t, func() bool {
+		return watcher.Current().(*watcherConfig).Foo == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	close(done)
+	wg.Wait()
+
+	second := watcher.Snapshot()
+	require.Equal(t, &watcherConfig{Foo: 2}, second.Config)
+	require.Greater(t, second.Version, first.Version)
+	require.False(t, second.LoadedAt.Before(first.LoadedAt))
+	// the previous snapshot is left untouched
+	require.Equal(t, &watcherConfig{Foo: 1}, first.Config)
+}
+
+func TestWatcher_ErrorHandler(t *testing.T) {
+	type config struct {
+		Foo int `kdl:"foo" validate:"max=10"`
+	}
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	errs := make(chan error, 4)
+	logger := &recordingLogger{}
+	watcher, err := WatchTyped[config](file, nil,
+		WithErrorHandler(func(err error) { errs <- err }),
+		WithWatchLogger(logger))
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	nextError := func() *ReloadError {
+		t.Helper()
+		select {
+		case err := <-errs:
+			var rerr *ReloadError
+			require.ErrorAs(t, err, &rerr)
+			return rerr
+		case <-time.After(2 * time.Second):
+			t.Fatal("reload error not reported")
+			return nil
+		}
+	}
+
+	// invalid configs are reported with their validation errors and counted
+	require.NoError(t, os.WriteFile(file, []byte("foo 11\n"), 0644))
+	rerr := nextError()
+	require.Equal(t, file, rerr.Path)
+	require.Equal(t, 1, rerr.Failures)
+	var verrs ValidationErrors
+	require.ErrorAs(t, rerr, &verrs)
+	require.Equal(t, "foo", verrs[0].Path)
+
+	require.NoError(t, os.WriteFile(file, []byte("foo 12\n"), 0644))
+	require.Equal(t, 2, nextError().Failures)
+	require.Equal(t, 1, watcher.Current().Foo)
+
+	// a successful reload resets the count
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	require.Eventually(t, func() bool { return watcher.Current().Foo == 2 }, 2*time.Second, 10*time.Millisecond)
+	require.NoError(t, os.WriteFile(file, []byte("foo 13\n"), 0644))
+	require.Equal(t, 1, nextError().Failures)
+
+	require.Contains(t, logger.messages(), "config reload failed")
+	require.Contains(t, logger.messages(), "config reloaded")
+}
+
+func TestWatcher_NilLoader(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	// a nil Loader leaves the default in place
+	watcher, err := WatchTyped[watcherConfig](file, nil, WithLoader(nil), WithManualReload())
+	require.NoError(t, err)
+	defer watcher.Stop()
+	require.Equal(t, 1, watcher.Current().Foo)
+
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	require.NoError(t, watcher.Reload())
+	require.Equal(t, 2, watcher.Current().Foo)
+}
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer() timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing the timers that expire.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		if t.armed && !t.when.After(c.now) {
+			t.armed = false
+			t.ch <- c.now
+		}
+	}
+}
+
+// next returns how long until the earliest armed timer fires, or false if none is armed.
+func (c *fakeClock) next() (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var next time.Duration
+	found := false
+	for _, t := range c.timers {
+		if d := t.when.Sub(c.now); t.armed && (!found || d < next) {
+			next, found = d, true
+		}
+	}
+	return next, found
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	ch    chan time.Time
+	when  time.Time
+	armed bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Reset(d time.Duration) {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.drain()
+	t.when, t.armed = t.clock.now.Add(d), true
+}
+
+func (t *fakeTimer) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.drain()
+	t.armed = false
+}
+
+func (t *fakeTimer) drain() {
+	select {
+	case <-t.ch:
+	default:
+	}
+}
+
+// expectArmed waits until the Watcher has armed a timer to fire in d on clk, then gives
+// straggling file events a moment to arrive.
+func expectArmed(t *testing.T, clk *fakeClock, d time.Duration) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		next, ok := clk.next()
+		return ok && next == d
+	}, 2*time.Second, 5*time.Millisecond, "no timer armed for %s", d)
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestWatcher_DebounceClock(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	clk := newFakeClock()
+	watcher, err := WatchTyped[watcherConfig](file, nil, WithDebounce(time.Second), withClock(clk))
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	expectArmed(t, clk, time.Second)
+
+	clk.Advance(999 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 1, watcher.Current().Foo)
+
+	clk.Advance(time.Millisecond)
+	require.Eventually(t, func() bool { return watcher.Current().Foo == 2 }, 2*time.Second, 5*time.Millisecond)
+	require.Equal(t, clk.Now(), watcher.LoadedAt())
+}
+
+func TestWatcher_Throttle(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	clk := newFakeClock()
+	watcher, err := WatchTyped[watcherConfig](file, nil,
+		WithDebounce(10*time.Millisecond), WithThrottle(time.Minute), withClock(clk))
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	expectArmed(t, clk, 10*time.Millisecond)
+
+	// the debounce has passed, but the previous load was less than a minute ago
+	clk.Advance(10 * time.Millisecond)
+	expectArmed(t, clk, time.Minute-10*time.Millisecond)
+	require.Equal(t, 1, watcher.Current().Foo)
+
+	clk.Advance(time.Minute - 10*time.Millisecond)
+	require.Eventually(t, func() bool { return watcher.Current().Foo == 2 }, 2*time.Second, 5*time.Millisecond)
+}
+
+func TestWatcher_StopWaitsForCallbacks(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	watcher, err := Watch(file, &watcherConfig{}, func(any) {
+		close(entered)
+		<-release
+	})
+	require.NoError(t, err)
+	<-entered
+
+	stopped := make(chan struct{})
+	go func() {
+		watcher.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned while a callback was running")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+	select {
+	case <-watcher.Done():
+	default:
+		t.Fatal("Done not closed after Stop")
+	}
+
+	// stopping again is a no-op
+	watcher.Stop()
+}
+
+func TestWatchContext(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watcher, err := WatchTypedContext[watcherConfig](ctx, file, nil)
+	require.NoError(t, err)
+
+	cancel()
+	select {
+	case <-watcher.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("watcher did not stop when its context was canceled")
+	}
+	watcher.Stop()
+
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, 1, watcher.Current().Foo)
+}
+
+func TestWatcher_OrderedDelivery(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	var mu sync.Mutex
+	var delivered []int
+	release := make(chan struct{})
+	watcher, err := WatchTyped(file, func(cfg *watcherConfig) {
+		if cfg.Foo == 1 {
+			// a slow consumer: reloads happen while the first callback runs
+			<-release
+		}
+		mu.Lock()
+		delivered = append(delivered, cfg.Foo)
+		mu.Unlock()
+	}, WithDebounce(time.Millisecond))
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	for i := 2; i <= 4; i++ {
+		require.NoError(t, os.WriteFile(file, []byte(fmt.Sprintf("foo %d\n", i)), 0644))
+		want := i
+		require.Eventually(t, func() bool { return watcher.Current().Foo == want }, 2*time.Second, 5*time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond) // let straggling events settle
+	close(release)
+
+	// only the latest config is delivered after the slow callback, never a stale one
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(delivered) == 2
+	}, 2*time.Second, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	require.Equal(t, []int{1, 4}, delivered)
+	mu.Unlock()
+}
+
+func TestWatcher_SyncDelivery(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	var delivered []int
+	watcher, err := WatchTyped(file, func(cfg *watcherConfig) {
+		delivered = append(delivered, cfg.Foo)
+	}, WithSyncDelivery())
+	require.NoError(t, err)
+	// the initial callback has returned by the time Watch does
+	require.Equal(t, []int{1}, delivered)
+
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	require.Eventually(t, func() bool { return watcher.Current().Foo == 2 }, 2*time.Second, 5*time.Millisecond)
+	// Stop waits for the watcher goroutine, which made the call
+	watcher.Stop()
+	require.Equal(t, []int{1, 2}, delivered)
+}
+
+func TestWatcher_BeforeApply(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	errPortInUse := errors.New("port in use")
+	type change struct{ old, new any }
+	changes := make(chan change, 4)
+	errs := make(chan error, 4)
+	watcher, err := WatchTyped[watcherConfig](file, nil,
+		WithBeforeApply(func(old, new any) error {
+			changes <- change{old, new}
+			if new.(*watcherConfig).Foo == 13 {
+				return errPortInUse
+			}
+			return nil
+		}),
+		WithErrorHandler(func(err error) { errs <- err }))
+	require.NoError(t, err)
+	defer watcher.Stop()
+	require.Equal(t, change{nil, &watcherConfig{Foo: 1}}, <-changes)
+
+	// a rejected config never goes live
+	require.NoError(t, os.WriteFile(file, []byte("foo 13\n"), 0644))
+	select {
+	case err := <-errs:
+		require.ErrorIs(t, err, ErrRejected)
+		require.ErrorIs(t, err, errPortInUse)
+	case <-time.After(2 * time.Second):
+		t.Fatal("rejection not reported")
+	}
+	require.Equal(t, change{&watcherConfig{Foo: 1}, &watcherConfig{Foo: 13}}, <-changes)
+	require.Equal(t, 1, watcher.Current().Foo)
+	require.Equal(t, uint64(1), watcher.Version())
+
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	require.Eventually(t, func() bool { return watcher.Current().Foo == 2 }, 2*time.Second, 5*time.Millisecond)
+}
+
+func TestWatcher_BeforeApplyInitial(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	_, err := Watch(file, &watcherConfig{}, func(any) {}, WithBeforeApply(func(old, new any) error {
+		return errors.New("no")
+	}))
+	require.ErrorIs(t, err, ErrRejected)
+}
+
+func TestWatcher_Rollback(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	ch := make(chan watcherConfig, 8)
+	watcher, err := WatchTyped(file, func(cfg *watcherConfig) {
+		ch <- *cfg
+	}, WithHistory(2))
+	require.NoError(t, err)
+	defer watcher.Stop()
+	expectFoo(t, ch, 1)
+	require.ErrorIs(t, watcher.Rollback(), ErrNoHistory)
+
+	for i := 2; i <= 4; i++ {
+		require.NoError(t, os.WriteFile(file, []byte(fmt.Sprintf("foo %d\n", i)), 0644))
+		expectFoo(t, ch, i)
+	}
+	// only the last two replaced configs are kept
+	history := watcher.History()
+	require.Len(t, history, 2)
+	require.Equal(t, 3, history[0].Config.Foo)
+	require.Equal(t, 2, history[1].Config.Foo)
+	version := watcher.Version()
+
+	require.NoError(t, watcher.Rollback())
+	expectFoo(t, ch, 3)
+	require.Equal(t, 3, watcher.Current().Foo)
+	require.Equal(t, version+1, watcher.Version())
+
+	require.NoError(t, watcher.Rollback())
+	expectFoo(t, ch, 2)
+	require.ErrorIs(t, watcher.Rollback(), ErrNoHistory)
+	require.Equal(t, 2, watcher.Current().Foo)
+
+	// the next change on disk is loaded as usual
+	require.NoError(t, os.WriteFile(file, []byte("foo 5\n"), 0644))
+	expectFoo(t, ch, 5)
+}
+
+func TestWatcher_CallbacksMayReadHistory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	// the callbacks look at the history while a reload or rollback is being applied
+	var watcher atomic.Pointer[TypedWatcher[watcherConfig]]
+	historyLen := func() int {
+		w := watcher.Load()
+		if w == nil {
+			return -1 // the initial load
+		}
+		return len(w.History())
+	}
+	delivered, approved := make(chan int, 4), make(chan int, 4)
+	w, err := WatchTyped(file, func(*watcherConfig) {
+		delivered <- historyLen()
+	}, WithSyncDelivery(), WithHistory(2), WithBeforeApply(func(old, new any) error {
+		approved <- historyLen()
+		return nil
+	}))
+	require.NoError(t, err)
+	defer w.Stop()
+	watcher.Store(w)
+
+	expect := func(ch <-chan int, want int) {
+		t.Helper()
+		select {
+		case got := <-ch:
+			require.Equal(t, want, got)
+		case <-time.After(2 * time.Second):
+			t.Fatal("callback not called: the Watcher deadlocked")
+		}
+	}
+	expect(approved, -1)
+	expect(delivered, -1)
+
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	expect(approved, 0)
+	expect(delivered, 1)
+
+	require.NoError(t, w.Rollback())
+	expect(approved, 1)
+	expect(delivered, 0)
+}
+
+func TestWatcher_DiffHandler(t *testing.T) {
+	type config struct {
+		Foo int `kdl:"foo"`
+		Log struct {
+			Level string `kdl:"level"`
+		} `kdl:"log"`
+	}
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\nlog {\n    level \"info\"\n}\n"), 0644))
+
+	type diff struct {
+		old     *config
+		changes []Change
+	}
+	diffs := make(chan diff, 4)
+	watcher, err := WatchTyped[config](file, nil, WithDiffHandler(func(old, new any, changes []Change) {
+		diffs <- diff{old.(*config), changes}
+	}))
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\nlog {\n    level \"debug\"\n}\n"), 0644))
+	select {
+	case d := <-diffs:
+		require.Equal(t, "info", d.old.Log.Level)
+		require.Equal(t, []Change{{Path: "log.level", Field: "Log.Level", Kind: Modified, Old: "info", New: "debug"}}, d.changes)
+	case <-time.After(2 * time.Second):
+		t.Fatal("diff not delivered")
+	}
+	watcher.Stop()
+	// neither the initial load nor anything else produced a diff
+	require.Empty(t, diffs)
+}
+
+func TestWatcher_Fragments(t *testing.T) {
+	type listener struct {
+		Addr string `kdl:"addr" validate:"required"`
+	}
+	type config struct {
+		Name      string     `kdl:"name"`
+		Listeners []listener `kdl:"listener,multiple"`
+	}
+	dir := writeFiles(t, map[string]string{
+		"app.kdl":              "name \"base\"\n",
+		"conf.d/10-http.kdl":   "listener addr=\":80\"\n",
+		"conf.d/20-https.kdl":  "listener addr=\":443\"\n",
+		"conf.d/README.md":     "not a config\n",
+		"conf.d/99-rename.kdl": "name \"renamed\"\n",
+	})
+	confd := filepath.Join(dir, "conf.d")
+
+	ch := make(chan config, 8)
+	watcher, err := WatchTyped(filepath.Join(dir, "app.kdl"), func(cfg *config) {
+		ch <- *cfg
+	}, WithFragments(filepath.Join(confd, "*.kdl")))
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	addrs := func(cfg config) []string {
+		var out []string
+		for _, l := range cfg.Listeners {
+			out = append(out, l.Addr)
+		}
+		return out
+	}
+	expect := func(name string, want ...string) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			select {
+			case cfg := <-ch:
+				return cfg.Name == name && reflect.DeepEqual(addrs(cfg), want)
+			default:
+				return false
+			}
+		}, 2*time.Second, 10*time.Millisecond, "config %s %v not delivered", name, want)
+	}
+	// fragments are merged in lexical order, each keeping its listeners
+	expect("renamed", ":80", ":443")
+
+	// a fragment added
+	require.NoError(t, os.WriteFile(filepath.Join(confd, "30-admin.kdl"), []byte("listener addr=\":9000\"\n"), 0644))
+	expect("renamed", ":80", ":443", ":9000")
+
+	// a fragment changed
+	require.NoError(t, os.WriteFile(filepath.Join(confd, "10-http.kdl"), []byte("listener addr=\":8080\"\n"), 0644))
+	expect("renamed", ":8080", ":443", ":9000")
+
+	// a fragment removed
+	require.NoError(t, os.Remove(filepath.Join(confd, "99-rename.kdl")))
+	expect("base", ":8080", ":443", ":9000")
+
+	// an invalid fragment is rejected like any other invalid config
+	require.NoError(t, os.WriteFile(filepath.Join(confd, "40-bad.kdl"), []byte("listener\n"), 0644))
+	time.Sleep(300 * time.Millisecond)
+	require.Equal(t, "base", watcher.Current().Name)
+	require.Len(t, watcher.Current().Listeners, 3)
+
+	// files the pattern does not match are ignored
+	version := watcher.Version()
+	require.NoError(t, os.Remove(filepath.Join(confd, "40-bad.kdl")))
+	expect("base", ":8080", ":443", ":9000")
+	require.NoError(t, os.WriteFile(filepath.Join(confd, "notes.txt"), []byte("listener\n"), 0644))
+	time.Sleep(300 * time.Millisecond)
+	require.Equal(t, version+1, watcher.Version())
+}
+
+func TestWatcher_Directory(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.kdl"), []byte("foo 1\n"), 0644))
+
+	ch := watchFoo(t, dir)
+	expectFoo(t, ch, 1)
+
+	// later files win
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.kdl"), []byte("foo 2\n"), 0644))
+	expectFoo(t, ch, 2)
+	require.NoError(t, os.Remove(filepath.Join(dir, "b.kdl")))
+	expectFoo(t, ch, 1)
+}
+
+func TestWatch_NoFragments(t *testing.T) {
+	watcher, err := Watch(filepath.Join(t.TempDir(), "*.kdl"), &watcherConfig{}, nil)
+	require.ErrorContains(t, err, "no config files match")
+	require.Nil(t, watcher)
+}
+
+func TestWatcher_Polling(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+	mtime := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(file, mtime, mtime))
+
+	ch := make(chan watcherConfig, 8)
+	watcher, err := Watch(dir, &watcherConfig{}, func(newCfg any) {
+		ch <- *newCfg.(*watcherConfig)
+	}, WithPolling(20*time.Millisecond), WithDebounce(10*time.Millisecond))
+	require.NoError(t, err)
+	defer watcher.Stop()
+	require.Nil(t, watcher.watcher)
+	expectFoo(t, ch, 1)
+
+	// same size and modification time: only the contents tell
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	require.NoError(t, os.Chtimes(file, mtime, mtime))
+	expectFoo(t, ch, 2)
+
+	// a fragment added and removed
+	extra := filepath.Join(dir, "extra.kdl")
+	require.NoError(t, os.WriteFile(extra, []byte("foo 3\n"), 0644))
+	expectFoo(t, ch, 3)
+	require.NoError(t, os.Remove(extra))
+	expectFoo(t, ch, 2)
+
+	// unrelated files and unchanged config files do not cause reloads
+	version := watcher.Version()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello\n"), 0644))
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, version, watcher.Version())
+}
+
+func TestWatcher_PollingFallback(t *testing.T) {
+	orig := newFSWatcher
+	newFSWatcher = func() (*fsnotify.Watcher, error) {
+		return nil, errors.New("inotify not supported")
+	}
+	defer func() { newFSWatcher = orig }()
+
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+	logger := &recordingLogger{}
+	clk := newFakeClock()
+	ch := make(chan watcherConfig, 8)
+	watcher, err := Watch(file, &watcherConfig{}, func(newCfg any) {
+		ch <- *newCfg.(*watcherConfig)
+	}, WithWatchLogger(logger), withClock(clk))
+	require.NoError(t, err)
+	defer watcher.Stop()
+	require.Contains(t, logger.messages(), "falling back to polling for config changes")
+	expectFoo(t, ch, 1)
+
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	// the change is seen by the next poll and reloaded once it settled
+	expectArmed(t, clk, defaultPollInterval)
+	clk.Advance(defaultPollInterval)
+	expectArmed(t, clk, defaultDebounce)
+	clk.Advance(defaultDebounce)
+	expectFoo(t, ch, 2)
+}
+
+func TestWatcher_PollingAfterReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+	clk := newFakeClock()
+	ch := make(chan watcherConfig, 8)
+	watcher, err := Watch(file, &watcherConfig{}, func(newCfg any) {
+		ch <- *newCfg.(*watcherConfig)
+	}, WithPolling(time.Second), withClock(clk))
+	require.NoError(t, err)
+	defer watcher.Stop()
+	expectFoo(t, ch, 1)
+
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	require.NoError(t, watcher.Reload())
+	expectFoo(t, ch, 2)
+	version := watcher.Version()
+
+	// the next poll finds the files as Reload read them and does not reload again
+	expectArmed(t, clk, time.Second)
+	clk.Advance(time.Second)
+	expectArmed(t, clk, time.Second)
+	require.Equal(t, version, watcher.Version())
+}
+
+func TestWatcher_ManualReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	var reported []error
+	watcher, err := WatchTyped[watcherConfig](file, nil, WithManualReload(), WithErrorHandler(func(err error) {
+		reported = append(reported, err)
+	}))
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	// file changes are not picked up
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	time.Sleep(300 * time.Millisecond)
+	require.Equal(t, 1, watcher.Current().Foo)
+
+	require.NoError(t, watcher.Reload())
+	require.Equal(t, 2, watcher.Current().Foo)
+	require.Equal(t, uint64(2), watcher.Version())
+
+	// a failed reload is returned rather than reported, and keeps the previous config
+	require.NoError(t, os.WriteFile(file, []byte("foo {\n"), 0644))
+	err = watcher.Reload()
+	var reloadErr *ReloadError
+	require.ErrorAs(t, err, &reloadErr)
+	require.Equal(t, 1, reloadErr.Failures)
+	require.Equal(t, 2, watcher.Current().Foo)
+
+	watcher.Stop()
+	require.Empty(t, reported)
+	require.ErrorIs(t, watcher.Reload(), ErrStopped)
+}
+
+func TestWatcher_ReloadFromCallbacks(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	var w atomic.Pointer[TypedWatcher[watcherConfig]]
+	fromHook := make(chan error, 1)
+	fromHandler := make(chan error, 1)
+	watcher, err := WatchTyped[watcherConfig](file, nil, WithManualReload(), WithReloadSignal(syscall.SIGHUP),
+		WithBeforeApply(func(old, new any) error {
+			if new.(*watcherConfig).Foo == 2 {
+				writeErr := os.WriteFile(file, []byte("foo 3\n"), 0644)
+				fromHook <- errors.Join(writeErr, w.Load().Reload())
+			}
+			return nil
+		}),
+		WithErrorHandler(func(err error) {
+			writeErr := os.WriteFile(file, []byte("foo 4\n"), 0644)
+			fromHandler <- errors.Join(writeErr, w.Load().Reload())
+		}))
+	require.NoError(t, err)
+	w.Store(watcher)
+	defer watcher.Stop()
+
+	// the hook's Reload goes live in place of the reload that called the hook
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	require.NoError(t, watcher.Reload())
+	require.NoError(t, <-fromHook)
+	require.Equal(t, 3, watcher.Current().Foo)
+	require.Equal(t, uint64(2), watcher.Version())
+
+	require.NoError(t, os.WriteFile(file, []byte("foo {\n"), 0644))
+	proc, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	if err := proc.Signal(syscall.SIGHUP); err != nil {
+		t.Skipf("cannot send SIGHUP: %v", err)
+	}
+	select {
+	case err := <-fromHandler:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("error handler not called")
+	}
+	require.Equal(t, 4, watcher.Current().Foo)
+}
+
+func TestWatcher_ReloadSignal(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.kdl")
+	require.NoError(t, os.WriteFile(file, []byte("foo 1\n"), 0644))
+
+	ch := make(chan watcherConfig, 8)
+	watcher, err := Watch(file, &watcherConfig{}, func(newCfg any) {
+		ch <- *newCfg.(*watcherConfig)
+	}, WithManualReload(), WithReloadSignal(syscall.SIGHUP))
+	require.NoError(t, err)
+	defer watcher.Stop()
+	expectFoo(t, ch, 1)
+
+	require.NoError(t, os.WriteFile(file, []byte("foo 2\n"), 0644))
+	proc, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	if err := proc.Signal(syscall.SIGHUP); err != nil {
+		t.Skipf("cannot send SIGHUP: %v", err)
+	}
+	expectFoo(t, ch, 2)
+}